@@ -0,0 +1,46 @@
+package avidbase
+
+import (
+	"errors"
+	"time"
+)
+
+// RotateAPIKey Replaces the api key of the account with a new one using machine access token. The client switches
+// to the new key, discarding the machine access token generated with the old one, and the new key is returned
+// so that it can be persisted. The old key stops working once the call succeeds
+func (c *Client) RotateAPIKey(opts ...CallOption) (newKey string, err error) {
+	if c.accountId == nil {
+		err = errors.New("invalid api key or unable to generate machine access token")
+		return
+	}
+
+	var output struct {
+		APIKey string `json:"api_key"`
+	}
+	// The key rotated is the one of the client, whatever the account of the call
+	rotateOpts := append(opts[:len(opts):len(opts)], withoutAccountOverride())
+	_, err = c.machineRequest("POST", "v1/account/"+*c.accountId+"/api_key:rotate", nil, nil, &output, "rotate api key", rotateOpts)
+	if err != nil {
+		return
+	}
+
+	if output.APIKey == "" {
+		err = errors.New("api key missing")
+		return
+	}
+
+	c.tokens.mu.Lock()
+	c.apiKey = &output.APIKey
+	c.tokens.machineAccessToken = nil
+	c.tokens.expiry = time.Time{}
+	c.tokens.mu.Unlock()
+
+	newKey = output.APIKey
+
+	return
+}
+
+// RotateAPIKey Replaces the api key of the account with a new one using the default client, see Client.RotateAPIKey
+func RotateAPIKey(opts ...CallOption) (newKey string, err error) {
+	return getDefaultClient().RotateAPIKey(opts...)
+}
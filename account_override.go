@@ -0,0 +1,56 @@
+package avidbase
+
+import "sync"
+
+// accountOverride The account a single call is made for, see WithAccountOverride
+type accountOverride struct {
+	accountId string
+	apiKey    string
+}
+
+// WithAccountOverride Makes a call that uses machine access token for the given account instead of the account of
+// the client, e.g. in a multi-tenant proxy serving several accounts with one client. The machine access token of
+// every account is generated once and cached separately, keyed by account id. The users of another account are never
+// served from the user cache. Login and the calls about the account of the client itself, such as RotateAPIKey and
+// VerifyCredentials, ignore it
+func WithAccountOverride(accountId, apiKey string) CallOption {
+	return func(c *callOptions) {
+		c.account = &accountOverride{accountId: accountId, apiKey: apiKey}
+	}
+}
+
+// withoutAccountOverride Clears the account override of a call, once handed to the client of the account
+func withoutAccountOverride() CallOption {
+	return func(c *callOptions) {
+		c.account = nil
+	}
+}
+
+// accountClients The clients made by WithAccount for the accounts of WithAccountOverride, keyed by account id
+type accountClients struct {
+	mu      sync.Mutex
+	clients map[string]*Client
+}
+
+// clear Resets and forgets the clients of all the accounts
+func (a *accountClients) clear() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for accountId, client := range a.clients {
+		// The clients share the accounts of the client, Reset would clear them again
+		client.resetState()
+		delete(a.clients, accountId)
+	}
+}
+
+// forAccount Returns the client of the given account, made on first use and replaced when its api key changes
+func (c *Client) forAccount(account accountOverride) *Client {
+	c.accounts.mu.Lock()
+	defer c.accounts.mu.Unlock()
+	client, ok := c.accounts.clients[account.accountId]
+	if !ok || StringValue(client.getAPIKey()) != account.apiKey {
+		client = c.WithAccount(account.accountId, account.apiKey)
+		c.accounts.clients[account.accountId] = client
+	}
+	return client
+}
@@ -2,25 +2,28 @@ package avidbase
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
-	"io/ioutil"
+	"io"
+	"net"
 	"net/http"
 	"net/mail"
+	"net/url"
 	"strconv"
-	"strings"
+	"time"
 )
 
-var baseUrl string
-
-var accountId *string
-var apiKey *string
-
-var machineAccessToken *string
-
 type AuthOutput struct {
-	User        Identity        `json:"user"`
-	Permissions map[string]bool `json:"permissions"`
+	User        Identity    `json:"user"`
+	Permissions Permissions `json:"permissions"`
+
+	// TokenExpires The expiry of the access token from the Access-Token-Expires header, zero if not sent
+	TokenExpires time.Time `json:"-"`
+	// TokenScope The scope of the access token from the Token-Scope header, empty if not sent
+	TokenScope string `json:"-"`
+	// MFAChallengeToken The token to pass to LoginWithMFA along with the code of the user, only set when Login
+	// fails with ErrMFARequired
+	MFAChallengeToken string `json:"-"`
 }
 
 type Identity struct {
@@ -31,6 +34,21 @@ type Identity struct {
 	Email     string                 `json:"email"`
 	Country   string                 `json:"country"`
 	Data      map[string]interface{} `json:"data"`
+
+	// Roles The role names of the user, only set by GetUser with WithExpand("roles")
+	Roles []string `json:"roles,omitempty"`
+	// Groups The groups of the user, only set by GetUser with WithExpand("groups")
+	Groups []Group `json:"groups,omitempty"`
+
+	// Status The status of the user, "active" or "deleted", deleted users are only returned with WithIncludeDeleted
+	Status string `json:"status,omitempty"`
+	// DeletedAt When the user was deleted, nil for an active user
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// IsDeleted Reports whether the user is deleted, only returned by the calls made with WithIncludeDeleted
+func (i Identity) IsDeleted() bool {
+	return i.Status == "deleted" || i.DeletedAt != nil
 }
 
 type User struct {
@@ -38,378 +56,910 @@ type User struct {
 	LastName  *string                `json:"last_name"`
 	Username  *string                `json:"username"`
 	Email     *string                `json:"email"`
+	Country   *string                `json:"country"`
 	Password  *string                `json:"password"`
 	Data      map[string]interface{} `json:"data"`
 }
 
-func Init(account, key string, isProduction bool) {
-	if isProduction {
-		baseUrl = "https://api.avidbase.com/"
-	} else {
-		baseUrl = "https://dev-api.avidbase.com/"
+// ToUser Returns a User holding the fields of the identity, e.g. to edit a user fetched by GetUser before passing
+// it to UpdateUser. Password is left nil and Data is a copy, changing it leaves the identity untouched
+func (i Identity) ToUser() User {
+	user := User{
+		FirstName: String(i.FirstName),
+		LastName:  String(i.LastName),
+		Username:  String(i.Username),
+		Email:     String(i.Email),
+		Country:   String(i.Country),
+	}
+	if i.Data != nil {
+		user.Data = make(map[string]interface{}, len(i.Data))
+		for key, value := range i.Data {
+			user.Data[key] = value
+		}
 	}
-	accountId = &account
-	apiKey = &key
+	return user
 }
 
-// isValidMachineAccessToken Validates whether the machine access token is available or not
-// if not available generate a new machine access token
-func isValidMachineAccessToken() bool {
-	return generateMachineAccessToken()
+// Init Configures the default client used by the package level functions.
+// It fails with ErrMissingAccount, leaving the default client unchanged, if the account or the key is empty,
+// and with the error of NewClient when an option is invalid.
+// The first successful Init wins: later calls fail with ErrAlreadyInitialized and leave the default client unchanged,
+// so that a library calling Init does not silently replace the configuration of the application.
+// Use Reinit to replace the configuration on purpose, or Reset to allow Init again
+func Init(account, key string, isProduction bool, opts ...Option) error {
+	client, err := NewClient(account, key, isProduction, opts...)
+	if err != nil {
+		return err
+	}
+	return initDefaultClient(client, false)
 }
 
-// generateMachineAccessToken Generates a new machine access token using api key
-func generateMachineAccessToken() bool {
-	if accountId == nil || apiKey == nil {
-		return false
-	}
-	values := map[string]string{"api_key": *apiKey}
-	jsonData, err := json.Marshal(values)
+// Reinit Configures the default client like Init, replacing the configuration of a previous Init if any.
+// Calls already running keep using the previous client
+func Reinit(account, key string, isProduction bool, opts ...Option) error {
+	client, err := NewClient(account, key, isProduction, opts...)
 	if err != nil {
-		return false
+		return err
 	}
+	return initDefaultClient(client, true)
+}
 
-	resp, err := http.Post(baseUrl+"v1/account/"+*accountId+"/token", "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return false
+// ensureMachineAccessToken Checks whether the machine access token is available or not,
+// if not available generates a new machine access token.
+// A token is reused until shortly before its expiry or until the api rejects it, tokens sent without expiry are
+// generated for every call
+func (c *Client) ensureMachineAccessToken(ctx context.Context) error {
+	c.tokens.mu.RLock()
+	valid := c.tokens.machineAccessToken != nil && !c.tokens.expiry.IsZero() &&
+		c.config.clock.Now().Add(tokenExpiryMargin).Before(c.tokens.expiry)
+	c.tokens.mu.RUnlock()
+	if valid {
+		return nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK || resp.Header.Get("Access-Token") == "" {
-		return false
+	return c.generateMachineAccessToken(ctx)
+}
+
+// generateMachineAccessToken Generates a new machine access token using api key.
+// Transient failures, such as network errors, 429 and 5xx responses, are retried up to tokenMaxAttempts times
+// unless ctx is done first, the error of the last attempt is returned
+func (c *Client) generateMachineAccessToken(ctx context.Context) (err error) {
+	var accessToken string
+	var expiry time.Time
+	for attempt := 1; ; attempt++ {
+		accessToken, expiry, err = c.fetchMachineAccessToken(ctx)
+		if err == nil || attempt >= tokenMaxAttempts || !isTransientTokenError(err) {
+			break
+		}
+		if sleep(ctx, c.config.clock, backoff(attempt, tokenRetryDelay, c.config.maxBackoff, c.config.jitter)) != nil {
+			break
+		}
 	}
+	if err != nil {
+		return
+	}
+
+	c.tokens.mu.Lock()
+	c.tokens.machineAccessToken = &accessToken
+	c.tokens.expiry = expiry
+	c.tokens.mu.Unlock()
 
-	accessToken := resp.Header.Get("Access-Token")
-	machineAccessToken = &accessToken
+	if c.config.onTokenRefresh != nil {
+		c.config.onTokenRefresh(expiry)
+	}
 
-	return true
+	return nil
 }
 
-// Login Authenticates the existing user using email/username and password
-func Login(emailOrUsername, password string) (accessToken string, output AuthOutput, err error) {
-	if accountId == nil || emailOrUsername == "" || password == "" {
-		err = errors.New("account, email/username or password is missing")
-		return
+// isTransientTokenError Reports whether a failed machine access token request may succeed when made again
+func isTransientTokenError(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return isRetryable(true, apiErr.StatusCode, nil, nil)
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
 	}
 
-	values := map[string]string{
-		"account_uuid": *accountId,
-		"password":     password,
+	// Every failure of http.Client.Do is a *url.Error, itself a net.Error, only some of them are transient.
+	// Certificate failures and redirect loops do not resolve themselves, the hooks and a closed client fail before
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return false
 	}
-	_, err = mail.ParseAddress(emailOrUsername)
+	var netErr net.Error
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(urlErr.Err, &netErr) && netErr.Timeout():
+		return true
+	case errors.As(urlErr.Err, &dnsErr):
+		return !dnsErr.IsNotFound
+	case errors.As(urlErr.Err, &opErr):
+		return true
+	}
+	// The connection was closed before the response was complete
+	return errors.Is(urlErr.Err, io.EOF) || errors.Is(urlErr.Err, io.ErrUnexpectedEOF)
+}
+
+// errAccessTokenMissing Returned when the api answers a call issuing a token without the Access-Token header
+var errAccessTokenMissing = errors.New("access token missing")
+
+// fetchMachineAccessToken Requests a new machine access token using api key, along with its expiry if sent
+func (c *Client) fetchMachineAccessToken(ctx context.Context) (accessToken string, expiry time.Time, err error) {
+	apiKey := c.getAPIKey()
+	if c.accountId == nil || apiKey == nil {
+		err = ErrNotInitialized
+		return
+	}
+	values := map[string]string{"api_key": *apiKey}
+	jsonData, err := c.config.codec.Marshal(values)
 	if err != nil {
-		values["username"] = emailOrUsername
-	} else {
-		values["email"] = emailOrUsername
+		err = errors.New("unable to json encode given api key")
+		return
 	}
 
-	jsonData, err := json.Marshal(values)
+	path := "v1/account/" + *c.accountId + "/token"
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseUrl+path, bytes.NewBuffer(jsonData))
 	if err != nil {
-		err = errors.New("unable to json encode given api key, email/username and password")
+		err = callError("POST", path, "unable to create a machine access token request", err)
 		return
 	}
+	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.Post(baseUrl+"v1/auth", "application/json", bytes.NewBuffer(jsonData))
+	resp, err := c.send(req)
 	if err != nil {
-		err = errors.New("unable to make an auth call")
+		err = callError("POST", path, "unable to make a machine access token call", err)
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		errorMessage, readErr := ioutil.ReadAll(resp.Body)
-		if readErr != nil {
-			err = errors.New("authentication failed, status code: " + strconv.Itoa(resp.StatusCode))
-			return
-		}
-		err = errors.New(strings.Trim(string(errorMessage), "\"") + ", status code: " + strconv.Itoa(resp.StatusCode))
+		err = c.newAPIError("POST", path, resp, "machine access token generation")
 		return
 	}
 
 	// Check if the access token is available or not
 	if resp.Header.Get("Access-Token") == "" {
-		err = errors.New("access token missing")
+		err = errAccessTokenMissing
 		return
 	}
 
-	//Decode the data
-	err = json.NewDecoder(resp.Body).Decode(&output)
-	if err != nil {
-		err = errors.New("unable to decode auth response")
-		return
-	}
-
-	// Set the user access token
 	accessToken = resp.Header.Get("Access-Token")
+	expiry = parseTokenExpiry(resp.Header.Get("Access-Token-Expires"))
 
 	return
 }
 
-// FindUser Finds a list of user matching given email or username and machine access token
-func FindUser(emailOrUsername string) (users []Identity, err error) {
-	if !isValidMachineAccessToken() {
-		err = errors.New("invalid api key or unable to generate machine access token")
+// getMachineAccessToken Returns the cached machine access token or an empty string if none is cached
+func (c *Client) getMachineAccessToken() string {
+	c.tokens.mu.RLock()
+	defer c.tokens.mu.RUnlock()
+	return StringValue(c.tokens.machineAccessToken)
+}
+
+// dropMachineAccessToken Discards the cached machine access token if it is still the given one, rejected by the api,
+// so that the next call generates a new one. A token replaced meanwhile by a concurrent call is kept
+func (c *Client) dropMachineAccessToken(rejected string) {
+	c.tokens.mu.Lock()
+	defer c.tokens.mu.Unlock()
+	if StringValue(c.tokens.machineAccessToken) == rejected {
+		c.tokens.machineAccessToken = nil
+		c.tokens.expiry = time.Time{}
+	}
+}
+
+// getAPIKey Returns the api key of the client, which RotateAPIKey may replace concurrently
+func (c *Client) getAPIKey() *string {
+	c.tokens.mu.RLock()
+	defer c.tokens.mu.RUnlock()
+	return c.apiKey
+}
+
+// HasMachineToken Reports whether a machine access token is cached, without generating one
+func (c *Client) HasMachineToken() bool {
+	c.tokens.mu.RLock()
+	defer c.tokens.mu.RUnlock()
+	return c.tokens.machineAccessToken != nil
+}
+
+// HasMachineToken Reports whether the default client has a machine access token cached, without generating one
+func HasMachineToken() bool {
+	return getDefaultClient().HasMachineToken()
+}
+
+// Login Authenticates the existing user using email/username and password.
+// It fails with ErrNotInitialized when the client has no account and with ErrMissingCredentials when the
+// email/username or the password is empty, without making a call.
+// For users with two-factor authentication it fails with ErrMFARequired instead of returning a token, the login
+// is then completed by LoginWithMFA using the MFAChallengeToken of output
+func (c *Client) Login(emailOrUsername, password string, opts ...CallOption) (accessToken string, output AuthOutput, err error) {
+	if c.accountId == nil {
+		err = ErrNotInitialized
+		return
+	}
+	if emailOrUsername == "" || password == "" {
+		err = ErrMissingCredentials
 		return
 	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", baseUrl+"v1/user:find", nil)
+	values := map[string]string{
+		"account_uuid": *c.accountId,
+		"password":     password,
+	}
+	_, err = mail.ParseAddress(emailOrUsername)
 	if err != nil {
-		err = errors.New("unable to create a find user request")
+		values["username"] = c.normalizeUsername(emailOrUsername)
+	} else {
+		values["email"] = emailOrUsername
+	}
+
+	jsonData, err := c.config.codec.Marshal(values)
+	if err != nil {
+		err = errors.New("unable to json encode given api key, email/username and password")
 		return
 	}
 
-	req.Header.Set("Access-Token", *machineAccessToken)
+	return c.authRequest("v1/auth", jsonData, opts)
+}
 
-	q := req.URL.Query()
-	q.Add("search_text", emailOrUsername)
-	req.URL.RawQuery = q.Encode()
+// Login Authenticates the existing user using email/username and password with the default client.
+// For users with two-factor authentication it fails with ErrMFARequired, see Client.Login
+func Login(emailOrUsername, password string, opts ...CallOption) (accessToken string, output AuthOutput, err error) {
+	return getDefaultClient().Login(emailOrUsername, password, opts...)
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		err = errors.New("unable to make a find user call")
+// LoginWithMFA Completes the login of a user with two-factor authentication using the challenge token returned
+// by Login along with ErrMFARequired and the code of the user's authenticator app. Fails with an error matching
+// ErrInvalidMFACode when the code is wrong or expired
+func (c *Client) LoginWithMFA(challengeToken, code string, opts ...CallOption) (accessToken string, output AuthOutput, err error) {
+	if c.accountId == nil {
+		err = ErrNotInitialized
 		return
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		errorMessage, readErr := ioutil.ReadAll(resp.Body)
-		if readErr != nil {
-			err = errors.New("get user failed, status code: " + strconv.Itoa(resp.StatusCode))
-			return
-		}
-		err = errors.New(strings.Trim(string(errorMessage), "\"") + ", status code: " + strconv.Itoa(resp.StatusCode))
+	if challengeToken == "" || code == "" {
+		err = errors.New("mfa challenge token or code is missing")
 		return
 	}
 
-	//Decode the data
-	err = json.NewDecoder(resp.Body).Decode(&users)
+	values := map[string]string{
+		"account_uuid":    *c.accountId,
+		"challenge_token": challengeToken,
+		"code":            code,
+	}
+	jsonData, err := c.config.codec.Marshal(values)
 	if err != nil {
-		err = errors.New("unable to decode a find user response")
+		err = errors.New("unable to json encode given mfa challenge token and code")
 		return
 	}
 
+	accessToken, output, err = c.authRequest("v1/auth/mfa:login", jsonData, opts)
+	markAPIError(err, http.StatusUnprocessableEntity, ErrInvalidMFACode)
 	return
 }
 
-// ListUsers Lists all the users using machine access token
-func ListUsers() (users []Identity, err error) {
-	users = make([]Identity, 0)
+// LoginWithMFA Completes the login of a user with two-factor authentication with the default client
+func LoginWithMFA(challengeToken, code string, opts ...CallOption) (accessToken string, output AuthOutput, err error) {
+	return getDefaultClient().LoginWithMFA(challengeToken, code, opts...)
+}
 
-	if !isValidMachineAccessToken() {
-		err = errors.New("invalid api key or unable to generate machine access token")
+// authRequest Makes an authentication call with the given json body, returning the user access token
+func (c *Client) authRequest(path string, jsonData []byte, opts []CallOption) (accessToken string, output AuthOutput, err error) {
+	call := newCallOptions(opts)
+	var endSpan func(error)
+	call.ctx, endSpan = c.startSpan(call.ctx, "POST", path)
+	defer func() { endSpan(err) }()
+	if timeout := c.config.timeoutFor("POST", path, false); timeout > 0 {
+		var cancel context.CancelFunc
+		call.ctx, cancel = context.WithTimeout(call.ctx, timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(call.ctx, "POST", c.baseUrl+path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		err = callError("POST", path, "unable to create an auth request", err)
 		return
 	}
+	req.Header.Set("Content-Type", "application/json")
+	requestId := c.setRequestId(call.ctx, req)
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", baseUrl+"v1/user", nil)
-	if err != nil {
-		err = errors.New("unable to create a list users request")
+	resp, err := c.send(req)
+	var hookErr *hookError
+	if errors.As(err, &hookErr) {
+		err = hookErr.err
 		return
 	}
-
-	req.Header.Set("Access-Token", *machineAccessToken)
-	resp, err := client.Do(req)
 	if err != nil {
-		err = errors.New("unable to make a list users call")
+		err = callError("POST", path, "unable to make an auth call", err)
 		return
 	}
 	defer resp.Body.Close()
+	call.setMeta(resp, requestId, 1)
+
+	// Users with two-factor authentication get a challenge to complete using LoginWithMFA instead of a token
+	if challengeToken := resp.Header.Get(mfaChallengeHeader); challengeToken != "" {
+		output.MFAChallengeToken = challengeToken
+		err = ErrMFARequired
+		return
+	}
 
 	if resp.StatusCode != http.StatusOK {
-		errorMessage, readErr := ioutil.ReadAll(resp.Body)
-		if readErr != nil {
-			err = errors.New("list users failed, status code: " + strconv.Itoa(resp.StatusCode))
-			return
-		}
-		err = errors.New(strings.Trim(string(errorMessage), "\"") + ", status code: " + strconv.Itoa(resp.StatusCode))
+		err = c.newAPIError("POST", path, resp, "authentication")
+		return
+	}
+
+	// Check if the access token is available or not
+	if resp.Header.Get("Access-Token") == "" {
+		err = errAccessTokenMissing
 		return
 	}
 
 	//Decode the data
-	err = json.NewDecoder(resp.Body).Decode(&users)
+	err = c.decode(resp.Body, &output)
+	if errors.Is(err, ErrResponseTooLarge) {
+		return
+	}
 	if err != nil {
-		err = errors.New("unable to decode a list users response")
+		err = callError("POST", path, "unable to decode auth response", nil)
 		return
 	}
 
+	// Set the user access token and its metadata
+	accessToken = resp.Header.Get("Access-Token")
+	output.TokenExpires = parseTokenExpiry(resp.Header.Get("Access-Token-Expires"))
+	output.TokenScope = resp.Header.Get("Token-Scope")
+
+	if c.config.requirePermissions && len(output.Permissions) == 0 {
+		err = ErrNoPermissions
+	}
+
 	return
 }
 
-// GetUser Get a user using user id and machine access token
-func GetUser(userId string) (user Identity, err error) {
-	if !isValidMachineAccessToken() {
-		err = errors.New("invalid api key or unable to generate machine access token")
+// GetPermissions Get the current permissions of the user owning the given user access token, e.g. to pick up
+// a role change without logging in again. It fails with an error matching ErrUnauthorized if the token expired
+func (c *Client) GetPermissions(accessToken string, opts ...CallOption) (permissions Permissions, err error) {
+	if accessToken == "" {
+		err = errors.New("access token is missing")
 		return
 	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", baseUrl+"v1/user/"+userId, nil)
-	if err != nil {
-		err = errors.New("unable to create a get user request")
+	opts = append(opts[:len(opts):len(opts)], WithAccessToken(accessToken))
+	_, err = c.machineRequest("GET", "v1/auth/permissions", nil, nil, &permissions, "get permissions", opts)
+	return
+}
+
+// GetPermissions Get the current permissions of the user owning the given user access token with the default client
+func GetPermissions(accessToken string, opts ...CallOption) (permissions Permissions, err error) {
+	return getDefaultClient().GetPermissions(accessToken, opts...)
+}
+
+// FindUser Finds a list of user matching given email or username and machine access token
+func (c *Client) FindUser(emailOrUsername string, opts ...CallOption) (users []Identity, err error) {
+	query := url.Values{}
+	query.Set("search_text", emailOrUsername)
+	call := newCallOptions(opts)
+	if err = call.addSort(query); err != nil {
 		return
 	}
-
-	req.Header.Set("Access-Token", *machineAccessToken)
-	resp, err := client.Do(req)
-	if err != nil {
-		err = errors.New("unable to make a get user call")
+	if err = call.addExclude(query); err != nil {
 		return
 	}
-	defer resp.Body.Close()
+	call.addIncludeDeleted(query)
+	_, err = c.machineRequest("GET", "v1/user:find", query, nil, &users, "find user", opts)
+	users = nonNilUsers(users)
+	call.maskUsers(users)
+	return
+}
 
-	if resp.StatusCode != http.StatusOK {
-		errorMessage, readErr := ioutil.ReadAll(resp.Body)
-		if readErr != nil {
-			err = errors.New("get user failed, status code: " + strconv.Itoa(resp.StatusCode))
-			return
-		}
-		err = errors.New(strings.Trim(string(errorMessage), "\"") + ", status code: " + strconv.Itoa(resp.StatusCode))
+// FindUser Finds a list of user matching given email or username and machine access token with the default client
+func FindUser(emailOrUsername string, opts ...CallOption) (users []Identity, err error) {
+	return getDefaultClient().FindUser(emailOrUsername, opts...)
+}
+
+// ListUsers Lists all the users using machine access token.
+// The list fetches one page at a time, when err is not nil users holds the pages fetched before the failure.
+// Like every method returning a list of users, users is never nil, an empty list is an empty slice
+func (c *Client) ListUsers(opts ...CallOption) (users []Identity, err error) {
+	return c.listAllUsers(nil, "list users", opts)
+}
+
+// ListUsers Lists all the users using machine access token with the default client.
+// When err is not nil users holds the pages fetched before the failure
+func ListUsers(opts ...CallOption) (users []Identity, err error) {
+	return getDefaultClient().ListUsers(opts...)
+}
+
+// ListUserIDs Lists the ids of all the users using machine access token, asking the api for the ids only,
+// e.g. to check which users exist without fetching them entirely
+func (c *Client) ListUserIDs(opts ...CallOption) (ids []string, err error) {
+	query := url.Values{}
+	query.Set("fields", "id")
+	users, err := c.listAllUsers(query, "list user ids", opts)
+
+	ids = make([]string, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	return
+}
+
+// ListUserIDs Lists the ids of all the users using machine access token with the default client
+func ListUserIDs(opts ...CallOption) (ids []string, err error) {
+	return getDefaultClient().ListUserIDs(opts...)
+}
+
+// ListUsersModifiedSince Lists the users created or updated after the given time using machine access token
+func (c *Client) ListUsersModifiedSince(t time.Time, opts ...CallOption) (users []Identity, err error) {
+	query := url.Values{}
+	query.Set("modified_since", t.UTC().Format(time.RFC3339))
+	return c.listAllUsers(query, "list modified users", opts)
+}
+
+// ListUsersModifiedSince Lists the users created or updated after the given time using machine access token with the default client
+func ListUsersModifiedSince(t time.Time, opts ...CallOption) (users []Identity, err error) {
+	return getDefaultClient().ListUsersModifiedSince(t, opts...)
+}
+
+// ListUsersCreatedBetween Lists the users created between start and end using machine access token.
+// It fails without making a call when start is after end
+func (c *Client) ListUsersCreatedBetween(start, end time.Time, opts ...CallOption) (users []Identity, err error) {
+	if start.After(end) {
+		return make([]Identity, 0), errors.New("invalid date range, start " + start.Format(time.RFC3339) +
+			" is after end " + end.Format(time.RFC3339))
+	}
+
+	query := url.Values{}
+	query.Set("created_after", start.UTC().Format(time.RFC3339))
+	query.Set("created_before", end.UTC().Format(time.RFC3339))
+	return c.listAllUsers(query, "list users created between", opts)
+}
+
+// ListUsersCreatedBetween Lists the users created between start and end using machine access token with the default client
+func ListUsersCreatedBetween(start, end time.Time, opts ...CallOption) (users []Identity, err error) {
+	return getDefaultClient().ListUsersCreatedBetween(start, end, opts...)
+}
+
+// SearchUsersText Lists all the users whose name, email or username matches the given free text using machine access
+// token, the api matching the text loosely across these fields, e.g. for a single search box
+func (c *Client) SearchUsersText(q string, opts ...CallOption) (users []Identity, err error) {
+	query := url.Values{}
+	query.Set("q", q)
+	return c.listAllUsers(query, "search users", opts)
+}
+
+// SearchUsersText Lists all the users whose name, email or username matches the given free text with the default client
+func SearchUsersText(q string, opts ...CallOption) (users []Identity, err error) {
+	return getDefaultClient().SearchUsersText(q, opts...)
+}
+
+// ListUsersByRole Lists all the users having the given role using machine access token
+func (c *Client) ListUsersByRole(role string, opts ...CallOption) (users []Identity, err error) {
+	query := url.Values{}
+	query.Set("role", role)
+	return c.listAllUsers(query, "list users by role", opts)
+}
+
+// ListUsersByRole Lists all the users having the given role using machine access token with the default client
+func ListUsersByRole(role string, opts ...CallOption) (users []Identity, err error) {
+	return getDefaultClient().ListUsersByRole(role, opts...)
+}
+
+// ListUsersCursor Lists a page of at most limit users starting at the given cursor using machine access token.
+// Pass an empty cursor for the first page, nextCursor is empty once the last page is reached
+func (c *Client) ListUsersCursor(cursor string, limit int, opts ...CallOption) (users []Identity, nextCursor string, err error) {
+	users = make([]Identity, 0)
+
+	query := url.Values{}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	call := newCallOptions(opts)
+	if err = call.addSort(query); err != nil {
 		return
 	}
+	if err = call.addExclude(query); err != nil {
+		return
+	}
+	call.addIncludeDeleted(query)
 
-	//Decode the data
-	err = json.NewDecoder(resp.Body).Decode(&user)
+	header, err := c.machineRequest("GET", "v1/user", query, nil, &users, "list users", opts)
+	users = nonNilUsers(users)
+	call.maskUsers(users)
 	if err != nil {
-		err = errors.New("unable to decode a get user response")
 		return
 	}
+	nextCursor = header.Get(nextCursorHeader)
 
 	return
 }
 
-// CreateUser Creates a new user using machine access token
-func CreateUser(user User) (identity Identity, err error) {
-	if !isValidMachineAccessToken() {
-		err = errors.New("invalid api key or unable to generate machine access token")
+// ListUsersCursor Lists a page of at most limit users starting at the given cursor with the default client
+func ListUsersCursor(cursor string, limit int, opts ...CallOption) (users []Identity, nextCursor string, err error) {
+	return getDefaultClient().ListUsersCursor(cursor, limit, opts...)
+}
+
+// PageInfo Describes a page of users returned by ListUsersPage or ListUsersPageToken
+type PageInfo struct {
+	// Total The number of users matching the list, -1 when the api did not report it
+	Total int
+	// Limit The page size used for the call
+	Limit int
+	// Offset The position of the first user of the page
+	Offset int
+	// HasMore Whether users follow this page
+	HasMore bool
+	// NextPageToken The token to pass to ListUsersPageToken for the next page, from the Link header of the response.
+	// Empty when the api did not send a next link
+	NextPageToken string
+	// PrevPageToken The token to pass to ListUsersPageToken for the previous page, from the Link header of the
+	// response. Empty when the api did not send a prev link
+	PrevPageToken string
+}
+
+// ListUsersPage Lists a page of at most limit users starting at offset using machine access token, along with
+// the total number of users and whether more pages follow. A limit of 0 uses the page size of the client
+func (c *Client) ListUsersPage(limit, offset int, opts ...CallOption) (users []Identity, page PageInfo, err error) {
+	users = make([]Identity, 0)
+
+	if limit <= 0 {
+		limit = c.config.pageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("offset", strconv.Itoa(offset))
+	call := newCallOptions(opts)
+	if err = call.addSort(query); err != nil {
 		return
 	}
+	if err = call.addExclude(query); err != nil {
+		return
+	}
+	call.addIncludeDeleted(query)
 
-	client := &http.Client{}
-	jsonData, err := json.Marshal(user)
+	return c.listUsersPage(query, opts)
+}
+
+// ListUsersPage Lists a page of at most limit users starting at offset with the default client
+func ListUsersPage(limit, offset int, opts ...CallOption) (users []Identity, page PageInfo, err error) {
+	return getDefaultClient().ListUsersPage(limit, offset, opts...)
+}
+
+// ListUsersPageToken Lists the page of users designated by the NextPageToken or PrevPageToken of a previous page
+// using machine access token
+func (c *Client) ListUsersPageToken(token string, opts ...CallOption) (users []Identity, page PageInfo, err error) {
+	users = make([]Identity, 0)
+
+	query, err := url.ParseQuery(token)
 	if err != nil {
-		err = errors.New("unable to json encode given user info")
+		err = errors.New("invalid page token")
 		return
 	}
+	if err = newCallOptions(opts).addExclude(query); err != nil {
+		return
+	}
+	newCallOptions(opts).addIncludeDeleted(query)
+
+	return c.listUsersPage(query, opts)
+}
+
+// ListUsersPageToken Lists the page of users designated by the token of a previous page with the default client
+func ListUsersPageToken(token string, opts ...CallOption) (users []Identity, page PageInfo, err error) {
+	return getDefaultClient().ListUsersPageToken(token, opts...)
+}
 
-	req, err := http.NewRequest("POST", baseUrl+"v1/user", bytes.NewBuffer(jsonData))
+// listUsersPage Lists the page of users selected by the given query, describing it using the pagination headers
+func (c *Client) listUsersPage(query url.Values, opts []CallOption) (users []Identity, page PageInfo, err error) {
+	users = make([]Identity, 0)
+	page = PageInfo{Total: -1}
+	page.Limit, _ = strconv.Atoi(query.Get("limit"))
+	page.Offset, _ = strconv.Atoi(query.Get("offset"))
+
+	header, err := c.machineRequest("GET", "v1/user", query, nil, &users, "list users", opts)
+	users = nonNilUsers(users)
+	newCallOptions(opts).maskUsers(users)
 	if err != nil {
-		err = errors.New("unable to create a create user request")
 		return
 	}
-	req.Header.Set("Access-Token", *machineAccessToken)
 
-	resp, err := client.Do(req)
-	if err != nil {
-		err = errors.New("unable to make a create user call")
+	page.NextPageToken, page.PrevPageToken = pageLinks(header)
+
+	// Without a next link nor a total a full page is assumed to be followed by another one
+	total, convErr := strconv.Atoi(header.Get(totalCountHeader))
+	if convErr == nil && total >= 0 {
+		page.Total = total
+	}
+	switch {
+	case page.NextPageToken != "":
+		page.HasMore = true
+	case page.Total >= 0:
+		page.HasMore = page.Offset+len(users) < page.Total
+	default:
+		page.HasMore = page.Limit > 0 && len(users) >= page.Limit
+	}
+
+	return
+}
+
+// GetUser Get a user using user id and machine access token.
+// Fails with an error matching ErrUserNotFound when the user does not exist, or is deleted without WithIncludeDeleted
+func (c *Client) GetUser(userId string, opts ...CallOption) (user Identity, err error) {
+	call := newCallOptions(opts)
+	query := url.Values{}
+	if err = call.addExpand(query); err != nil {
 		return
 	}
-	defer resp.Body.Close()
+	if err = call.addExclude(query); err != nil {
+		return
+	}
+	call.addIncludeDeleted(query)
 
-	if resp.StatusCode != http.StatusOK {
-		errorMessage, readErr := ioutil.ReadAll(resp.Body)
-		if readErr != nil {
-			err = errors.New("create user failed, status code: " + strconv.Itoa(resp.StatusCode))
+	// A call asking for the response meta reaches the api to fill it, the fetched user is still cached
+	cacheable := len(query) == 0 && len(call.queryParams) == 0 && call.accessToken == "" && call.account == nil
+	if cacheable && call.meta == nil {
+		// A closed client fails even for cached users, as every other call does
+		if c.isClosed() {
+			err = ErrClientClosed
+			return
+		}
+		var ok bool
+		if user, ok = c.users.get(userId); ok {
 			return
 		}
-		err = errors.New(strings.Trim(string(errorMessage), "\"") + ", status code: " + strconv.Itoa(resp.StatusCode))
-		return
 	}
 
-	//Decode the data
-	err = json.NewDecoder(resp.Body).Decode(&identity)
-	if err != nil {
-		err = errors.New("unable to decode a create user response")
+	_, err = c.machineRequest("GET", "v1/user/"+userId, query, nil, &user, "get user", opts)
+	markAPIError(err, http.StatusNotFound, ErrUserNotFound)
+	call.maskUser(&user)
+	if err == nil && cacheable {
+		c.users.set(userId, user)
+	}
+	return
+}
+
+// GetUser Get a user using user id and machine access token with the default client
+func GetUser(userId string, opts ...CallOption) (user Identity, err error) {
+	return getDefaultClient().GetUser(userId, opts...)
+}
+
+// GetUserInto Get a user using user id and machine access token, decoding the user json directly into out,
+// which should be a pointer to a struct with json tags such as an application's own user model.
+// It skips the typed Identity entirely, so the json field names of the api apply.
+// Fails with an error matching ErrUserNotFound when the user does not exist, or is deleted without WithIncludeDeleted
+func (c *Client) GetUserInto(userId string, out interface{}, opts ...CallOption) (err error) {
+	call := newCallOptions(opts)
+	query := url.Values{}
+	if err = call.addExpand(query); err != nil {
+		return
+	}
+	if err = call.addExclude(query); err != nil {
 		return
 	}
+	call.addIncludeDeleted(query)
 
+	_, err = c.machineRequest("GET", "v1/user/"+userId, query, nil, out, "get user", opts)
+	markAPIError(err, http.StatusNotFound, ErrUserNotFound)
 	return
 }
 
-// UpdateUser Updates an existing user using user id and machine access token
-func UpdateUser(userId string, user User) (identity Identity, err error) {
-	if !isValidMachineAccessToken() {
-		err = errors.New("invalid api key or unable to generate machine access token")
+// GetUserInto Get a user using user id, decoding it directly into out, with the default client
+func GetUserInto(userId string, out interface{}, opts ...CallOption) (err error) {
+	return getDefaultClient().GetUserInto(userId, out, opts...)
+}
+
+// CreateUser Creates a new user using machine access token
+func (c *Client) CreateUser(user User, opts ...CallOption) (identity Identity, err error) {
+	if user.Username != nil {
+		// user is a copy, pointing it at the normalized username leaves the caller's username untouched
+		user.Username = String(c.normalizeUsername(*user.Username))
+	}
+	if (user.Country == nil || *user.Country == "") && c.config.defaultCountry != "" {
+		user.Country = String(c.config.defaultCountry)
+	}
+	if err = c.validatePassword(user.Password); err != nil {
 		return
 	}
+	if user.Data != nil {
+		if err = c.validateData(user.Data); err != nil {
+			return
+		}
+	}
 
-	client := &http.Client{}
-	jsonData, err := json.Marshal(user)
+	query := url.Values{}
+	if newCallOptions(opts).suppressNotifications {
+		query.Set("suppress_notifications", "true")
+	}
+
+	header, err := c.machineRequest("POST", "v1/user", query, user, &identity, "create user", opts)
 	if err != nil {
-		err = errors.New("unable to json encode given user info")
 		return
 	}
 
-	req, err := http.NewRequest("PUT", baseUrl+"v1/user/"+userId, bytes.NewBuffer(jsonData))
-	if err != nil {
-		err = errors.New("unable to create an update user request")
+	// Servers answering 201 with an empty body only send the new user url in the Location header
+	if identity.ID == "" {
+		identity.ID = resourceId(header.Get("Location"))
+	}
+
+	return
+}
+
+// CreateUser Creates a new user using machine access token with the default client
+func CreateUser(user User, opts ...CallOption) (identity Identity, err error) {
+	return getDefaultClient().CreateUser(user, opts...)
+}
+
+// UpsertUser Creates a new user, or returns the existing user with the same email or username, using machine
+// access token. created reports whether the user was newly created. Unlike checking for the user before creating it,
+// there is no window where a concurrent signup can slip in: the conflict reported by the api decides
+func (c *Client) UpsertUser(user User, opts ...CallOption) (identity Identity, created bool, err error) {
+	identity, err = c.CreateUser(user, opts...)
+	if err == nil {
+		created = true
 		return
 	}
-	req.Header.Set("Access-Token", *machineAccessToken)
 
-	resp, err := client.Do(req)
-	if err != nil {
-		err = errors.New("unable to make an update user call")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		errorMessage, readErr := ioutil.ReadAll(resp.Body)
-		if readErr != nil {
-			err = errors.New("update user failed, status code: " + strconv.Itoa(resp.StatusCode))
+	// The user already exists, fetch it using the identifier that conflicted, the username as CreateUser sent it
+	identifiers := []string{StringValue(user.Email)}
+	if user.Username != nil {
+		identifiers = append(identifiers, c.normalizeUsername(*user.Username))
+	}
+	for _, emailOrUsername := range identifiers {
+		if emailOrUsername == "" {
+			continue
+		}
+
+		users, findErr := c.FindUser(emailOrUsername, opts...)
+		if findErr != nil {
+			return Identity{}, false, findErr
+		}
+		for _, existing := range users {
+			if existing.Email == emailOrUsername || existing.Username == emailOrUsername {
+				return existing, false, nil
+			}
+		}
+	}
+
+	return
+}
+
+// UpsertUser Creates a new user, or returns the existing user with the same email or username, with the default client
+func UpsertUser(user User, opts ...CallOption) (identity Identity, created bool, err error) {
+	return getDefaultClient().UpsertUser(user, opts...)
+}
+
+// UpdateUser Updates an existing user using user id and machine access token
+func (c *Client) UpdateUser(userId string, user User, opts ...CallOption) (identity Identity, err error) {
+	if user.Data != nil {
+		if err = c.validateData(user.Data); err != nil {
 			return
 		}
-		err = errors.New(strings.Trim(string(errorMessage), "\"") + ", status code: " + strconv.Itoa(resp.StatusCode))
-		return
 	}
 
-	//Decode the data
-	err = json.NewDecoder(resp.Body).Decode(&identity)
-	if err != nil {
-		err = errors.New("unable to decode an update user response")
+	defer c.users.delete(userId)
+	_, err = c.machineRequest("PUT", "v1/user/"+userId, nil, user, &identity, "update user", opts)
+	return
+}
+
+// UpdateUser Updates an existing user using user id and machine access token with the default client
+func UpdateUser(userId string, user User, opts ...CallOption) (identity Identity, err error) {
+	return getDefaultClient().UpdateUser(userId, user, opts...)
+}
+
+// UpdateUserData Replaces the custom data of an existing user using user id and machine access token,
+// keys missing from data are removed from the user. The other user fields are left untouched
+func (c *Client) UpdateUserData(userId string, data map[string]interface{}, opts ...CallOption) (identity Identity, err error) {
+	if err = c.validateData(data); err != nil {
 		return
 	}
 
+	defer c.users.delete(userId)
+	_, err = c.machineRequest("PUT", "v1/user/"+userId+"/data", nil, data, &identity, "update user data", opts)
+	return
+}
+
+// UpdateUserData Replaces the custom data of an existing user with the default client
+func UpdateUserData(userId string, data map[string]interface{}, opts ...CallOption) (identity Identity, err error) {
+	return getDefaultClient().UpdateUserData(userId, data, opts...)
+}
+
+// MergeUserData Merges the given keys into the custom data of an existing user using user id and machine access token,
+// keys missing from data are kept and keys set to nil are removed. The other user fields are left untouched.
+// The merged data is not validated against the schema set by WithDataSchema, only the api knows the resulting data
+func (c *Client) MergeUserData(userId string, data map[string]interface{}, opts ...CallOption) (identity Identity, err error) {
+	defer c.users.delete(userId)
+	_, err = c.machineRequest("PATCH", "v1/user/"+userId+"/data", nil, data, &identity, "merge user data", opts)
+	return
+}
+
+// MergeUserData Merges the given keys into the custom data of an existing user with the default client
+func MergeUserData(userId string, data map[string]interface{}, opts ...CallOption) (identity Identity, err error) {
+	return getDefaultClient().MergeUserData(userId, data, opts...)
+}
+
+// DeleteUser Deletes an existing user using user id and machine access token
+func (c *Client) DeleteUser(userId string, opts ...CallOption) (err error) {
+	defer c.users.delete(userId)
+	_, err = c.machineRequest("DELETE", "v1/user/"+userId, nil, nil, nil, "delete user", opts)
 	return
 }
 
+// DeleteUser Deletes an existing user using user id and machine access token with the default client
+func DeleteUser(userId string, opts ...CallOption) (err error) {
+	return getDefaultClient().DeleteUser(userId, opts...)
+}
+
 // AddUserRole Add the RBAC role to the existing user using user id, machine access token and role name
-func AddUserRole(userId, roleName string) (err error) {
-	if !isValidMachineAccessToken() {
-		err = errors.New("invalid api key or unable to generate machine access token")
-		return
-	}
+func (c *Client) AddUserRole(userId, roleName string, opts ...CallOption) (err error) {
+	defer c.users.delete(userId)
+	_, err = c.machineRequest("PUT", "v1/user/"+userId+"/role/"+roleName, nil, nil, nil, "add user role", opts)
+	return
+}
 
-	client := &http.Client{}
+// AddUserRole Add the RBAC role to the existing user using user id, machine access token and role name with the default client
+func AddUserRole(userId, roleName string, opts ...CallOption) (err error) {
+	return getDefaultClient().AddUserRole(userId, roleName, opts...)
+}
 
-	req, err := http.NewRequest("PUT", baseUrl+"v1/user/"+userId+"/role/"+roleName, nil)
+// ImpersonateUser Generates a user access token for the given user id using machine access token, so that
+// support staff can act on behalf of that user.
+//
+// The returned token carries the full permissions of the impersonated user and should be treated like a password:
+// keep it short-lived, never hand it to anyone other than the operator who requested it and audit its use.
+// The api key must belong to an account with the impersonation permission, otherwise the call is rejected.
+func (c *Client) ImpersonateUser(userId string, opts ...CallOption) (accessToken string, err error) {
+	header, err := c.machineRequest("POST", "v1/user/"+userId+"/impersonate", nil, nil, nil, "impersonate user", opts)
 	if err != nil {
-		err = errors.New("unable to create an add user role request")
 		return
 	}
-	req.Header.Set("Access-Token", *machineAccessToken)
 
-	resp, err := client.Do(req)
-	if err != nil {
-		err = errors.New("unable to make a add user role call")
+	// Check if the access token is available or not
+	if header.Get("Access-Token") == "" {
+		err = errAccessTokenMissing
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		errorMessage, readErr := ioutil.ReadAll(resp.Body)
-		if readErr != nil {
-			err = errors.New("add user role failed, status code: " + strconv.Itoa(resp.StatusCode))
-			return
-		}
-		err = errors.New(strings.Trim(string(errorMessage), "\"") + ", status code: " + strconv.Itoa(resp.StatusCode))
-		return
-	}
+	accessToken = header.Get("Access-Token")
 
 	return
 }
 
+// ImpersonateUser Generates a user access token for the given user id with the default client, see Client.ImpersonateUser
+func ImpersonateUser(userId string, opts ...CallOption) (accessToken string, err error) {
+	return getDefaultClient().ImpersonateUser(userId, opts...)
+}
+
+// parseTokenExpiry Parses an access token expiry sent either as a RFC 3339 or http date or as unix seconds,
+// returning the zero time if it is missing or malformed
+func parseTokenExpiry(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	if expiry, err := time.Parse(time.RFC3339, value); err == nil {
+		return expiry
+	}
+	if expiry, err := http.ParseTime(value); err == nil {
+		return expiry
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0)
+	}
+	return time.Time{}
+}
+
 // String returns a pointer to the string value passed in.
 func String(v string) *string {
 	return &v
@@ -0,0 +1,76 @@
+package avidbase
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestListMethodsReturnNonNilSlices(t *testing.T) {
+	for _, body := range []string{"", "null"} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/account/acc/token" {
+				w.Header().Set("Access-Token", "token")
+				return
+			}
+			_, _ = w.Write([]byte(body))
+		}))
+		client, err := NewClient("acc", "key", false, WithBaseURL(srv.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		now := time.Now()
+		methods := map[string]func() (interface{}, error){
+			"FindUser":    func() (interface{}, error) { return client.FindUser("user@example.com") },
+			"ListUsers":   func() (interface{}, error) { return client.ListUsers() },
+			"ListUserIDs": func() (interface{}, error) { return client.ListUserIDs() },
+			"ListUsersModifiedSince": func() (interface{}, error) {
+				return client.ListUsersModifiedSince(now)
+			},
+			"ListUsersCreatedBetween": func() (interface{}, error) {
+				return client.ListUsersCreatedBetween(now.Add(-time.Hour), now)
+			},
+			"SearchUsersText": func() (interface{}, error) { return client.SearchUsersText("bob") },
+			"ListUsersByRole": func() (interface{}, error) { return client.ListUsersByRole("admin") },
+			"ListUsersCursor": func() (interface{}, error) {
+				users, _, err := client.ListUsersCursor("", 10)
+				return users, err
+			},
+			"ListUsersPage": func() (interface{}, error) {
+				users, _, err := client.ListUsersPage(10, 0)
+				return users, err
+			},
+			"ListUsersPageToken": func() (interface{}, error) {
+				users, _, err := client.ListUsersPageToken("limit=10&offset=10")
+				return users, err
+			},
+			"GetUserGroups": func() (interface{}, error) { return client.GetUserGroups("123") },
+		}
+		for name, method := range methods {
+			result, err := method()
+			if err != nil {
+				t.Errorf("%s with body %q: %v", name, body, err)
+				continue
+			}
+			switch list := result.(type) {
+			case []Identity:
+				if list == nil || len(list) != 0 {
+					t.Errorf("%s with body %q = %#v, want an empty non nil slice", name, body, list)
+				}
+			case []string:
+				if list == nil || len(list) != 0 {
+					t.Errorf("%s with body %q = %#v, want an empty non nil slice", name, body, list)
+				}
+			case []Group:
+				if list == nil || len(list) != 0 {
+					t.Errorf("%s with body %q = %#v, want an empty non nil slice", name, body, list)
+				}
+			default:
+				t.Errorf("%s returned an unexpected %T", name, result)
+			}
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,268 @@
+// Package avidbasetest provides a fake avidbase api for testing code using the sdk
+// without reaching the real api.
+package avidbasetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	avidbase "github.com/AvidBase/avidbase-sdk-go"
+)
+
+const (
+	// AccountID The account accepted by the fake server
+	AccountID = "test-account"
+	// APIKey The api key accepted by the fake server
+	APIKey = "test-api-key"
+	// MachineToken The machine access token issued for APIKey
+	MachineToken = "test-machine-token"
+	// UserToken The user access token issued on a successful login
+	UserToken = "test-user-token"
+)
+
+// Server A fake avidbase api serving token, login, list, find, get, create, update and delete user calls
+// from an in memory set of users
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	users     []avidbase.Identity
+	passwords map[string]string
+	nextId    int
+	failures  map[string]int
+}
+
+// NewServer Starts a fake api, callers should Close it when done
+func NewServer() *Server {
+	s := &Server{
+		passwords: make(map[string]string),
+		failures:  make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Client Returns a client for AccountID and APIKey pointed at the fake api
+func (s *Server) Client(opts ...avidbase.Option) *avidbase.Client {
+	opts = append([]avidbase.Option{avidbase.WithBaseURL(s.URL)}, opts...)
+	client, err := avidbase.NewClient(AccountID, APIKey, false, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
+
+// AddUser Adds a user to the fake api, password allows the user to login and may be empty.
+// A user without id gets one generated, the stored user is returned
+func (s *Server) AddUser(user avidbase.Identity, password string) avidbase.Identity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user.ID == "" {
+		s.nextId++
+		user.ID = "user-" + strconv.Itoa(s.nextId)
+	}
+	s.users = append(s.users, user)
+	if password != "" {
+		s.passwords[user.ID] = password
+	}
+	return user
+}
+
+// Users Returns the users currently stored in the fake api
+func (s *Server) Users() []avidbase.Identity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]avidbase.Identity(nil), s.users...)
+}
+
+// Fail Makes the calls with given method and path, e.g. "GET" and "/v1/user/user-1", respond with the given
+// status code such as http.StatusUnauthorized or http.StatusInternalServerError until ClearFailures is called
+func (s *Server) Fail(method, path string, statusCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[method+" "+path] = statusCode
+}
+
+// ClearFailures Removes all the failures set using Fail
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = make(map[string]int)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if statusCode, ok := s.failures[r.Method+" "+r.URL.Path]; ok {
+		writeError(w, statusCode, http.StatusText(statusCode))
+		return
+	}
+
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/v1/account/"+AccountID+"/token":
+		s.token(w, r)
+	case r.Method == "POST" && r.URL.Path == "/v1/auth":
+		s.login(w, r)
+	case r.Header.Get("Access-Token") != MachineToken:
+		writeError(w, http.StatusUnauthorized, "invalid access token")
+	case r.Method == "GET" && r.URL.Path == "/v1/user":
+		s.listUsers(w, r)
+	case r.Method == "GET" && r.URL.Path == "/v1/user:find":
+		s.findUser(w, r)
+	case r.Method == "POST" && r.URL.Path == "/v1/user":
+		s.createUser(w, r)
+	case strings.HasPrefix(r.URL.Path, "/v1/user/") && !strings.Contains(r.URL.Path[len("/v1/user/"):], "/"):
+		s.user(w, r, r.URL.Path[len("/v1/user/"):])
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	var values map[string]string
+	if json.NewDecoder(r.Body).Decode(&values) != nil || values["api_key"] != APIKey {
+		writeError(w, http.StatusUnauthorized, "invalid api key")
+		return
+	}
+	w.Header().Set("Access-Token", MachineToken)
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	var values map[string]string
+	if json.NewDecoder(r.Body).Decode(&values) != nil || values["account_uuid"] != AccountID {
+		writeError(w, http.StatusBadRequest, "invalid auth request")
+		return
+	}
+
+	for _, user := range s.users {
+		if (values["email"] != "" && values["email"] == user.Email) ||
+			(values["username"] != "" && values["username"] == user.Username) {
+			if password, ok := s.passwords[user.ID]; ok && password == values["password"] {
+				w.Header().Set("Access-Token", UserToken)
+				writeJSON(w, avidbase.AuthOutput{User: user, Permissions: avidbase.Permissions{}})
+				return
+			}
+			break
+		}
+	}
+	writeError(w, http.StatusUnauthorized, "invalid credentials")
+}
+
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request) {
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = len(s.users)
+	}
+
+	users := make([]avidbase.Identity, 0)
+	for i := offset; i >= 0 && i < len(s.users) && len(users) < limit; i++ {
+		users = append(users, s.users[i])
+	}
+	w.Header().Set("Total-Count", strconv.Itoa(len(s.users)))
+	writeJSON(w, users)
+}
+
+func (s *Server) findUser(w http.ResponseWriter, r *http.Request) {
+	searchText := r.URL.Query().Get("search_text")
+
+	users := make([]avidbase.Identity, 0)
+	for _, user := range s.users {
+		if user.Email == searchText || user.Username == searchText {
+			users = append(users, user)
+		}
+	}
+	writeJSON(w, users)
+}
+
+func (s *Server) createUser(w http.ResponseWriter, r *http.Request) {
+	var user avidbase.User
+	if json.NewDecoder(r.Body).Decode(&user) != nil {
+		writeError(w, http.StatusBadRequest, "invalid user")
+		return
+	}
+
+	s.nextId++
+	identity := apply(avidbase.Identity{ID: "user-" + strconv.Itoa(s.nextId)}, user)
+	s.users = append(s.users, identity)
+	if user.Password != nil {
+		s.passwords[identity.ID] = *user.Password
+	}
+	writeJSON(w, identity)
+}
+
+func (s *Server) user(w http.ResponseWriter, r *http.Request, userId string) {
+	index := -1
+	for i, user := range s.users {
+		if user.ID == userId {
+			index = i
+		}
+	}
+	if index < 0 {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	switch r.Method {
+	case "GET", "HEAD":
+		writeJSON(w, s.users[index])
+	case "PUT":
+		var user avidbase.User
+		if json.NewDecoder(r.Body).Decode(&user) != nil {
+			writeError(w, http.StatusBadRequest, "invalid user")
+			return
+		}
+		s.users[index] = apply(s.users[index], user)
+		if user.Password != nil {
+			s.passwords[userId] = *user.Password
+		}
+		writeJSON(w, s.users[index])
+	case "DELETE":
+		s.users = append(s.users[:index], s.users[index+1:]...)
+		delete(s.passwords, userId)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// apply Copies the fields set in user over identity
+func apply(identity avidbase.Identity, user avidbase.User) avidbase.Identity {
+	if user.FirstName != nil {
+		identity.FirstName = *user.FirstName
+	}
+	if user.LastName != nil {
+		identity.LastName = *user.LastName
+	}
+	if user.Username != nil {
+		identity.Username = *user.Username
+	}
+	if user.Email != nil {
+		identity.Email = *user.Email
+	}
+	if user.Country != nil {
+		identity.Country = *user.Country
+	}
+	if user.Data != nil {
+		identity.Data = user.Data
+	}
+	return identity
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	w.WriteHeader(statusCode)
+	_, _ = w.Write([]byte(strconv.Quote(message)))
+}
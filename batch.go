@@ -0,0 +1,257 @@
+package avidbase
+
+import (
+	"sort"
+	"sync"
+)
+
+// DeleteResult Reports the outcome of deleting several users
+type DeleteResult struct {
+	Succeeded []string
+	Failed    map[string]error
+}
+
+// DeleteUsers Deletes the users with given ids concurrently using machine access token.
+// A failed deletion does not stop the others, every id ends up either in Succeeded or in Failed with its reason.
+// The error is only set when the call context is done before all the users were processed
+func (c *Client) DeleteUsers(ids []string, opts ...CallOption) (result DeleteResult, err error) {
+	call := newCallOptions(opts)
+	deleteOpts := call.itemOptions()
+	result = DeleteResult{
+		Succeeded: make([]string, 0, len(ids)),
+		Failed:    make(map[string]error),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan string)
+	for i := 0; i < c.config.batchConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range jobs {
+				deleteErr := c.DeleteUser(id, deleteOpts...)
+
+				mu.Lock()
+				if deleteErr != nil {
+					result.Failed[id] = deleteErr
+				} else {
+					result.Succeeded = append(result.Succeeded, id)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i, id := range ids {
+		select {
+		case jobs <- id:
+			continue
+		case <-call.ctx.Done():
+			err = call.ctx.Err()
+		}
+
+		mu.Lock()
+		for _, skipped := range ids[i:] {
+			result.Failed[skipped] = err
+		}
+		mu.Unlock()
+		break
+	}
+	close(jobs)
+	wg.Wait()
+
+	return
+}
+
+// DeleteUsers Deletes the users with given ids concurrently with the default client, see Client.DeleteUsers
+func DeleteUsers(ids []string, opts ...CallOption) (result DeleteResult, err error) {
+	return getDefaultClient().DeleteUsers(ids, opts...)
+}
+
+// CreateUserResult Reports the outcome of creating one of the users given to CreateUsersStream
+type CreateUserResult struct {
+	// Index The position of the user in the given users
+	Index int
+	// Identity The created user, empty when Err is set
+	Identity Identity
+	// Err The reason the user was not created
+	Err error
+}
+
+// CreateUsersStream Creates the given users concurrently using machine access token, delivering the result of every
+// user on the returned channel as soon as it completes, in no particular order. The channel is closed once all
+// the users were processed. When the call context is done the remaining users are not created, their results carry
+// the context error. The channel is buffered for all the users, so that it does not need to be drained
+func (c *Client) CreateUsersStream(users []User, opts ...CallOption) <-chan CreateUserResult {
+	call := newCallOptions(opts)
+	createOpts := call.itemOptions()
+	if call.suppressNotifications {
+		createOpts = append(createOpts, WithSuppressNotifications())
+	}
+
+	results := make(chan CreateUserResult, len(users))
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for i := 0; i < c.config.batchConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				identity, createErr := c.CreateUser(users[index], createOpts...)
+				results <- CreateUserResult{Index: index, Identity: identity, Err: createErr}
+			}
+		}()
+	}
+
+	go func() {
+		for i := range users {
+			select {
+			case jobs <- i:
+				continue
+			case <-call.ctx.Done():
+			}
+
+			for skipped := i; skipped < len(users); skipped++ {
+				results <- CreateUserResult{Index: skipped, Err: call.ctx.Err()}
+			}
+			break
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// CreateUsersStream Creates the given users concurrently with the default client, see Client.CreateUsersStream
+func CreateUsersStream(users []User, opts ...CallOption) <-chan CreateUserResult {
+	return getDefaultClient().CreateUsersStream(users, opts...)
+}
+
+// BatchFailure Describes a user of a batch that failed
+type BatchFailure struct {
+	// Index The position of the user in the given users for CreateUsers, in the sorted user ids for UpdateUsersData
+	Index int
+	// UserID The id of the user, only set by UpdateUsersData
+	UserID string
+	// Input The user as given, only set by CreateUsers
+	Input User
+	// Data The data as given for the user, only set by UpdateUsersData
+	Data map[string]interface{}
+	// Err The reason the user failed
+	Err error
+}
+
+// BatchResult Reports the outcome of creating or updating several users with CreateUsers or UpdateUsersData
+type BatchResult struct {
+	// Succeeded The created or updated users, in the order of the given users for CreateUsers and of the sorted
+	// user ids for UpdateUsersData
+	Succeeded []Identity
+	// Failed The users that were not created or updated, in the same order, e.g. to retry just those
+	Failed []BatchFailure
+}
+
+// CreateUsers Creates the given users concurrently using machine access token. A failed creation does not stop
+// the others, every user ends up either in Succeeded or in Failed along with its index and reason. Users not created
+// because the call context got done fail with the context error.
+// The error is only set when the batch could not start at all, e.g. on a closed client or an already done context
+func (c *Client) CreateUsers(users []User, opts ...CallOption) (result BatchResult, err error) {
+	result = BatchResult{Succeeded: make([]Identity, 0, len(users)), Failed: make([]BatchFailure, 0)}
+	if err = c.batchStartError(newCallOptions(opts)); err != nil {
+		return
+	}
+
+	results := make([]CreateUserResult, len(users))
+	for r := range c.CreateUsersStream(users, opts...) {
+		results[r.Index] = r
+	}
+	for i, r := range results {
+		if r.Err != nil {
+			result.Failed = append(result.Failed, BatchFailure{Index: i, Input: users[i], Err: r.Err})
+		} else {
+			result.Succeeded = append(result.Succeeded, r.Identity)
+		}
+	}
+	return
+}
+
+// CreateUsers Creates the given users concurrently with the default client, see Client.CreateUsers
+func CreateUsers(users []User, opts ...CallOption) (result BatchResult, err error) {
+	return getDefaultClient().CreateUsers(users, opts...)
+}
+
+// UpdateUsersData Replaces the data of several users concurrently using machine access token, updates mapping
+// the user ids to their new data. The users are processed in the order of their ids, which gives the indexes of
+// the result. A failed update does not stop the others, every user ends up either in Succeeded or in Failed along
+// with its id, data and reason. Users not updated because the call context got done fail with the context error.
+// The error is only set when the batch could not start at all, e.g. on a closed client or an already done context
+func (c *Client) UpdateUsersData(updates map[string]map[string]interface{}, opts ...CallOption) (result BatchResult, err error) {
+	call := newCallOptions(opts)
+	result = BatchResult{Succeeded: make([]Identity, 0, len(updates)), Failed: make([]BatchFailure, 0)}
+	if err = c.batchStartError(call); err != nil {
+		return
+	}
+
+	ids := make([]string, 0, len(updates))
+	for id := range updates {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	identities := make([]Identity, len(ids))
+	errs := make([]error, len(ids))
+	updateOpts := call.itemOptions()
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for i := 0; i < c.config.batchConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				identities[index], errs[index] = c.UpdateUserData(ids[index], updates[ids[index]], updateOpts...)
+			}
+		}()
+	}
+
+	for i := range ids {
+		select {
+		case jobs <- i:
+			continue
+		case <-call.ctx.Done():
+		}
+
+		for skipped := i; skipped < len(ids); skipped++ {
+			errs[skipped] = call.ctx.Err()
+		}
+		break
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, id := range ids {
+		if errs[i] != nil {
+			result.Failed = append(result.Failed, BatchFailure{Index: i, UserID: id, Data: updates[id], Err: errs[i]})
+		} else {
+			result.Succeeded = append(result.Succeeded, identities[i])
+		}
+	}
+	return
+}
+
+// UpdateUsersData Replaces the data of several users concurrently with the default client, see Client.UpdateUsersData
+func UpdateUsersData(updates map[string]map[string]interface{}, opts ...CallOption) (result BatchResult, err error) {
+	return getDefaultClient().UpdateUsersData(updates, opts...)
+}
+
+// batchStartError Returns the error preventing a batch from starting, nil when it can start
+func (c *Client) batchStartError(call callOptions) error {
+	switch {
+	case c.accountId == nil:
+		return ErrNotInitialized
+	case c.isClosed():
+		return ErrClientClosed
+	}
+	return call.ctx.Err()
+}
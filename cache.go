@@ -0,0 +1,120 @@
+package avidbase
+
+import (
+	"sync"
+	"time"
+)
+
+// WithUserCache Caches the users returned by GetUser for ttl, up to maxEntries users, so that repeated reads of the
+// same users within ttl do not reach the api. A user is evicted when updated, deleted or given a role through the
+// client, and using InvalidateUser. Calls using WithExpand or WithAccessToken bypass the cache, calls using
+// WithResponseMeta always reach the api so that the meta is filled.
+// The cached users are shared between the calls, their Data should not be modified
+func WithUserCache(ttl time.Duration, maxEntries int) Option {
+	return func(o *options) {
+		o.userCacheTTL = ttl
+		o.userCacheMaxEntries = maxEntries
+	}
+}
+
+// userCache The users cached by GetUser, by user id
+type userCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	clock      Clock
+	entries    map[string]cachedUser
+}
+
+type cachedUser struct {
+	user    Identity
+	expires time.Time
+}
+
+// newUserCache Returns the user cache configured by WithUserCache, nil when caching is disabled
+func newUserCache(o options) *userCache {
+	if o.userCacheTTL <= 0 || o.userCacheMaxEntries <= 0 {
+		return nil
+	}
+	return &userCache{
+		ttl:        o.userCacheTTL,
+		maxEntries: o.userCacheMaxEntries,
+		clock:      o.clock,
+		entries:    make(map[string]cachedUser),
+	}
+}
+
+// get Returns the cached user with the given id unless missing or expired
+func (u *userCache) get(userId string) (Identity, bool) {
+	if u == nil {
+		return Identity{}, false
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	entry, ok := u.entries[userId]
+	if !ok {
+		return Identity{}, false
+	}
+	if u.clock.Now().After(entry.expires) {
+		delete(u.entries, userId)
+		return Identity{}, false
+	}
+	return entry.user, true
+}
+
+// set Caches the given user, evicting the expired users, or the user closest to expiry, when the cache is full
+func (u *userCache) set(userId string, user Identity) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := u.clock.Now()
+	if _, ok := u.entries[userId]; !ok && len(u.entries) >= u.maxEntries {
+		oldestId := ""
+		for id, entry := range u.entries {
+			if now.After(entry.expires) {
+				delete(u.entries, id)
+			} else if oldestId == "" || entry.expires.Before(u.entries[oldestId].expires) {
+				oldestId = id
+			}
+		}
+		if len(u.entries) >= u.maxEntries {
+			delete(u.entries, oldestId)
+		}
+	}
+	u.entries[userId] = cachedUser{user: user, expires: now.Add(u.ttl)}
+}
+
+// delete Evicts the user with the given id
+func (u *userCache) delete(userId string) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	delete(u.entries, userId)
+	u.mu.Unlock()
+}
+
+// clear Evicts all the users
+func (u *userCache) clear() {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	u.entries = make(map[string]cachedUser)
+	u.mu.Unlock()
+}
+
+// InvalidateUser Evicts the user with the given id from the cache set by WithUserCache, so that the next GetUser
+// reaches the api, e.g. after the user was changed by another service
+func (c *Client) InvalidateUser(userId string) {
+	c.users.delete(userId)
+}
+
+// InvalidateUser Evicts the user with the given id from the cache of the default client
+func InvalidateUser(userId string) {
+	getDefaultClient().InvalidateUser(userId)
+}
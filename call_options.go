@@ -0,0 +1,332 @@
+package avidbase
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// sortFields The fields the list and search calls can be sorted by
+var sortFields = []string{"first_name", "last_name", "username", "email", "country", "created_at", "updated_at"}
+
+// expandFields The related data GetUser can include in the user
+var expandFields = []string{"roles", "groups"}
+
+// excludableFields The user fields the get and list calls can leave out
+var excludableFields = []string{"first_name", "last_name", "username", "email", "country", "data"}
+
+// CallOption Configures a single api call, e.g. GetUser(userId, WithContext(ctx))
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	ctx  context.Context
+	meta *ResponseMeta
+
+	idempotencyKey string
+
+	sortField string
+	sortDesc  bool
+
+	expand  []string
+	exclude []string
+
+	includeDeleted bool
+
+	accessToken string
+	account     *accountOverride
+
+	suppressNotifications bool
+
+	revokeToken bool
+
+	ifMatch string
+
+	queryParams url.Values
+}
+
+// ResponseMeta Holds the details of the http response behind an api call
+type ResponseMeta struct {
+	StatusCode int
+	RequestID  string
+	Header     http.Header
+	// Attempts The number of requests made for the call, more than one when it was retried
+	Attempts int
+
+	// Location The url of the created resource from the Location header, if sent
+	Location string
+	// ResourceID The id of the created resource, parsed from the last segment of Location
+	ResourceID string
+
+	// ETag The version of the returned resource from the ETag header, if sent
+	ETag string
+	// TotalCount The number of users matching a list from the Total-Count header, -1 if not sent
+	TotalCount int
+}
+
+// newCallOptions Applies the given call options over the defaults
+func newCallOptions(opts []CallOption) callOptions {
+	call := callOptions{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(&call)
+	}
+	return call
+}
+
+// itemOptions Returns the options of the calls a batch makes for each of its items: the context, the access token
+// and the account of the batch apply to every item, the options meant for a single call such as WithIdempotencyKey
+// or WithResponseMeta do not
+func (c callOptions) itemOptions() []CallOption {
+	return []CallOption{func(item *callOptions) {
+		item.ctx = c.ctx
+		item.accessToken = c.accessToken
+		item.account = c.account
+	}}
+}
+
+// WithContext Makes the call using the given context for cancellation, deadlines and request scoped values
+func WithContext(ctx context.Context) CallOption {
+	return func(c *callOptions) {
+		if ctx != nil {
+			c.ctx = ctx
+		}
+	}
+}
+
+// WithResponseMeta Fills the given meta with the details of the response once the call completes
+func WithResponseMeta(meta *ResponseMeta) CallOption {
+	return func(c *callOptions) {
+		c.meta = meta
+	}
+}
+
+// setMeta Records the response details into the meta requested by the caller, if any
+func (c callOptions) setMeta(resp *http.Response, requestId string, attempts int) {
+	if c.meta == nil {
+		return
+	}
+	c.meta.StatusCode = resp.StatusCode
+	c.meta.RequestID = requestId
+	c.meta.Header = resp.Header
+	c.meta.Attempts = attempts
+	c.meta.Location = resp.Header.Get("Location")
+	c.meta.ResourceID = resourceId(c.meta.Location)
+	c.meta.ETag = resp.Header.Get("ETag")
+	c.meta.TotalCount = -1
+	if total, err := strconv.Atoi(resp.Header.Get(totalCountHeader)); err == nil && total >= 0 {
+		c.meta.TotalCount = total
+	}
+}
+
+// resourceId Returns the last path segment of a resource url, e.g. "123" for "https://api.avidbase.com/v1/user/123"
+func resourceId(location string) string {
+	u, err := url.Parse(location)
+	if err != nil || u.Path == "" {
+		return ""
+	}
+	return path.Base(strings.TrimSuffix(u.Path, "/"))
+}
+
+// WithIdempotencyKey Sends the given Idempotency-Key header with a write call so that the api applies it only once,
+// even when it is retried, and lets non idempotent calls such as creating a user be retried on server errors and
+// network failures, which is only safe if the api honours the key. Write calls get a generated key when retries
+// are enabled and none is given, sent on their retries on 429 only
+func WithIdempotencyKey(key string) CallOption {
+	return func(c *callOptions) {
+		c.idempotencyKey = key
+	}
+}
+
+// WithIfMatch Sends the given If-Match header with a write call so that the api only applies it while the resource
+// still has the given ETag, see ResponseMeta.ETag. A call made on a changed resource fails with an error matching
+// ErrConflict
+func WithIfMatch(etag string) CallOption {
+	return func(c *callOptions) {
+		c.ifMatch = etag
+	}
+}
+
+// WithSort Sorts the users returned by the list and search calls by the given field, one of first_name, last_name,
+// username, email, country, created_at or updated_at, in descending order if desc is set
+func WithSort(field string, desc bool) CallOption {
+	return func(c *callOptions) {
+		c.sortField = field
+		c.sortDesc = desc
+	}
+}
+
+// addSort Adds the sort and order parameters to the query of a list call, failing on an unknown sort field
+func (c callOptions) addSort(query url.Values) error {
+	if c.sortField == "" {
+		return nil
+	}
+
+	if !contains(sortFields, c.sortField) {
+		return errors.New("unknown sort field " + c.sortField + ", must be one of " + strings.Join(sortFields, ", "))
+	}
+
+	query.Set("sort", c.sortField)
+	if c.sortDesc {
+		query.Set("order", "desc")
+	} else {
+		query.Set("order", "asc")
+	}
+	return nil
+}
+
+// WithExpand Includes the given related data, "roles" and/or "groups", in the user returned by GetUser,
+// saving the calls otherwise needed to fetch them
+func WithExpand(fields ...string) CallOption {
+	return func(c *callOptions) {
+		c.expand = append(c.expand, fields...)
+	}
+}
+
+// addExpand Adds the expand parameter to the query of a get call, failing on an unknown field
+func (c callOptions) addExpand(query url.Values) error {
+	if len(c.expand) == 0 {
+		return nil
+	}
+
+	for _, field := range c.expand {
+		if !contains(expandFields, field) {
+			return errors.New("unknown expand field " + field + ", must be one of " + strings.Join(expandFields, ", "))
+		}
+	}
+	query.Set("expand", strings.Join(c.expand, ","))
+	return nil
+}
+
+// WithExcludeFields Asks the api to leave the given fields, among first_name, last_name, username, email, country
+// and data, out of the users returned by the get and list calls, e.g. to avoid fetching personal data that is not
+// needed. The corresponding Identity fields are left zero, even if the api sent them anyway
+func WithExcludeFields(fields ...string) CallOption {
+	return func(c *callOptions) {
+		c.exclude = append(c.exclude, fields...)
+	}
+}
+
+// addExclude Adds the exclude_fields parameter to the query of a get or list call, failing on an unknown field
+func (c callOptions) addExclude(query url.Values) error {
+	if len(c.exclude) == 0 {
+		return nil
+	}
+
+	for _, field := range c.exclude {
+		if !contains(excludableFields, field) {
+			return errors.New("unknown excluded field " + field + ", must be one of " + strings.Join(excludableFields, ", "))
+		}
+	}
+	query.Set("exclude_fields", strings.Join(c.exclude, ","))
+	return nil
+}
+
+// WithIncludeDeleted Includes the deleted users in the results of the get and list calls, e.g. to review or restore
+// them, see Identity.IsDeleted. Deleted users are left out by default, GetUser failing with ErrUserNotFound for them
+func WithIncludeDeleted() CallOption {
+	return func(c *callOptions) {
+		c.includeDeleted = true
+	}
+}
+
+// addIncludeDeleted Adds the include_deleted parameter to the query of a get or list call when requested
+func (c callOptions) addIncludeDeleted(query url.Values) {
+	if c.includeDeleted {
+		query.Set("include_deleted", "true")
+	}
+}
+
+// maskUser Clears the excluded fields of the given user
+func (c callOptions) maskUser(user *Identity) {
+	for _, field := range c.exclude {
+		switch field {
+		case "first_name":
+			user.FirstName = ""
+		case "last_name":
+			user.LastName = ""
+		case "username":
+			user.Username = ""
+		case "email":
+			user.Email = ""
+		case "country":
+			user.Country = ""
+		case "data":
+			user.Data = nil
+		}
+	}
+}
+
+// maskUsers Clears the excluded fields of the given users
+func (c callOptions) maskUsers(users []Identity) {
+	for i := range users {
+		c.maskUser(&users[i])
+	}
+}
+
+// contains Reports whether values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// WithAccessToken Makes a call that normally uses the machine access token with the given token instead,
+// e.g. a user access token to act as that user. The given token always takes precedence: no machine access token
+// is generated for the call and the api decides whether the token is allowed to make it
+func WithAccessToken(token string) CallOption {
+	return func(c *callOptions) {
+		c.accessToken = token
+	}
+}
+
+// WithSuppressNotifications Creates a user with CreateUser without sending the welcome email to the new user,
+// e.g. while migrating existing users. Emails the user triggers later, such as password resets, are still sent
+func WithSuppressNotifications() CallOption {
+	return func(c *callOptions) {
+		c.suppressNotifications = true
+	}
+}
+
+// WithRevokeToken Revokes the machine access token generated by VerifyCredentials once the check is done,
+// so that no token outlives the check
+func WithRevokeToken() CallOption {
+	return func(c *callOptions) {
+		c.revokeToken = true
+	}
+}
+
+// WithQueryParam Adds the given query parameter to the call, e.g. to use a parameter of the api the sdk does not
+// support yet. It can be repeated, including with the same key. Parameters set by the sdk itself, such as the
+// pagination ones, take precedence: a parameter with the same key as one of them is ignored
+func WithQueryParam(key, value string) CallOption {
+	return func(c *callOptions) {
+		if c.queryParams == nil {
+			c.queryParams = url.Values{}
+		}
+		c.queryParams.Add(key, value)
+	}
+}
+
+// addQueryParams Returns the query of the call, the parameters given by WithQueryParam added to the sdk ones
+func (c callOptions) addQueryParams(query url.Values) url.Values {
+	if len(c.queryParams) == 0 {
+		return query
+	}
+
+	all := url.Values{}
+	for key, values := range query {
+		all[key] = values
+	}
+	for key, values := range c.queryParams {
+		if _, managed := query[key]; !managed {
+			all[key] = values
+		}
+	}
+	return all
+}
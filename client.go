@@ -0,0 +1,195 @@
+package avidbase
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Client Makes api calls on behalf of an account. The package level functions use a default client
+// configured by Init, create a Client with NewClient to work with several accounts or configurations
+type Client struct {
+	baseUrl   string
+	accountId *string
+	apiKey    *string
+
+	config     options
+	httpClient *http.Client
+	semaphore  chan struct{}
+
+	tokens *tokenState
+	users  *userCache
+
+	// accounts The clients of the accounts given by WithAccountOverride, shared with the copies made by WithAccount
+	accounts *accountClients
+
+	// closed Set to 1 by Close
+	closed *int32
+	// ownerClosed The closed flag of the client whose transport a copy made by WithAccount shares, nil for that client
+	ownerClosed *int32
+}
+
+// tokenState Holds the machine access token of a client, shared by all its concurrent calls.
+// Its mutex also guards the api key of the client
+type tokenState struct {
+	mu                 sync.RWMutex
+	machineAccessToken *string
+	expiry             time.Time
+}
+
+// tokenExpiryMargin How long before its expiry a machine access token is replaced, so that it does not expire mid call
+const tokenExpiryMargin = 30 * time.Second
+
+// tokenMaxAttempts The number of attempts made to generate a machine access token before giving up
+const tokenMaxAttempts = 3
+
+// tokenRetryDelay The base delay between the attempts to generate a machine access token
+const tokenRetryDelay = 200 * time.Millisecond
+
+// defaultClient The client used by the package level functions, replaced by Init and Reset
+var defaultClient = newClient("", nil, nil, defaultOptions())
+var defaultClientMu sync.RWMutex
+
+// getDefaultClient Returns the client used by the package level functions
+func getDefaultClient() *Client {
+	defaultClientMu.RLock()
+	defer defaultClientMu.RUnlock()
+	return defaultClient
+}
+
+// setDefaultClient Replaces the client used by the package level functions
+func setDefaultClient(client *Client) {
+	defaultClientMu.Lock()
+	defaultClient = client
+	defaultClientMu.Unlock()
+}
+
+// initDefaultClient Replaces the client used by the package level functions by the given one, failing with
+// ErrAlreadyInitialized unless replace is set if the default client was already configured by Init
+func initDefaultClient(client *Client, replace bool) error {
+	defaultClientMu.Lock()
+	defer defaultClientMu.Unlock()
+	if !replace && defaultClient.accountId != nil {
+		return ErrAlreadyInitialized
+	}
+	defaultClient = client
+	return nil
+}
+
+// NewClient Creates a client for the given account and api key, failing with ErrMissingAccount if either is empty
+// and when the schema given to WithDataSchema is invalid or uses keywords that are not supported
+func NewClient(account, key string, isProduction bool, opts ...Option) (*Client, error) {
+	if strings.TrimSpace(account) == "" || strings.TrimSpace(key) == "" {
+		return nil, ErrMissingAccount
+	}
+
+	config := defaultOptions()
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if config.dataSchemaErr != nil {
+		return nil, errors.New("invalid data schema: " + config.dataSchemaErr.Error())
+	}
+
+	baseUrl := "https://dev-api.avidbase.com/"
+	if isProduction {
+		baseUrl = "https://api.avidbase.com/"
+	}
+	if config.baseUrl != "" {
+		baseUrl = config.baseUrl
+	}
+
+	return newClient(baseUrl, &account, &key, config), nil
+}
+
+func newClient(baseUrl string, accountId, apiKey *string, config options) *Client {
+	c := &Client{
+		baseUrl:    baseUrl,
+		accountId:  accountId,
+		apiKey:     apiKey,
+		config:     config,
+		httpClient: newHTTPClient(config),
+		tokens:     config.newTokenState(accountId),
+		users:      newUserCache(config),
+		closed:     new(int32),
+		accounts:   &accountClients{clients: make(map[string]*Client)},
+	}
+	if config.maxConcurrentRequests > 0 {
+		c.semaphore = make(chan struct{}, config.maxConcurrentRequests)
+	}
+	return c
+}
+
+// WithAccount Returns a copy of the client targeting another account. The copy shares the configuration,
+// the transport, with its idle connections, and the concurrent requests limit but caches its own machine access token,
+// unless a token cache is shared by WithSharedTokenCache
+func (c *Client) WithAccount(accountId, apiKey string) *Client {
+	clone := *c
+	clone.accountId = &accountId
+	clone.apiKey = &apiKey
+	clone.tokens = c.config.newTokenState(&accountId)
+	clone.users = newUserCache(c.config)
+	clone.closed = new(int32)
+	if clone.ownerClosed == nil {
+		clone.ownerClosed = c.closed
+	}
+	return &clone
+}
+
+// Reset Clears the cached state of the client, its machine access token, those of the accounts of
+// WithAccountOverride and cached users, so that the next call starts afresh. It is safe to call while other calls
+// are running, they keep the state they already read
+func (c *Client) Reset() {
+	c.resetState()
+	c.accounts.clear()
+}
+
+// resetState Clears the machine access token and the cached users of the client
+func (c *Client) resetState() {
+	c.tokens.mu.Lock()
+	c.tokens.machineAccessToken = nil
+	c.tokens.expiry = time.Time{}
+	c.tokens.mu.Unlock()
+	c.users.clear()
+}
+
+// Reset Clears the cached state of the default client and restores it to its state before Init, so that
+// tests reconfiguring the sdk do not leak tokens or configuration into each other. Init can be called again afterwards
+func Reset() {
+	getDefaultClient().Reset()
+	setDefaultClient(newClient("", nil, nil, defaultOptions()))
+}
+
+// Close Releases the idle connections of the client. The client is unusable afterwards, its calls fail with
+// ErrClientClosed. The copies made by WithAccount share the transport of the client and are closed along with it,
+// while closing a copy only makes that copy unusable, leaving the transport to the client it was made from
+func (c *Client) Close() error {
+	atomic.StoreInt32(c.closed, 1)
+	if c.ownerClosed == nil {
+		c.httpClient.CloseIdleConnections()
+	}
+	return nil
+}
+
+// isClosed Reports whether the client, or the client whose transport it shares, was closed
+func (c *Client) isClosed() bool {
+	return atomic.LoadInt32(c.closed) != 0 || (c.ownerClosed != nil && atomic.LoadInt32(c.ownerClosed) != 0)
+}
+
+type clientContextKey struct{}
+
+// ContextWithClient Returns a copy of ctx carrying the given client, e.g. for a middleware to hand a client
+// configured for the request to the handlers, which retrieve it using ClientFromContext
+func ContextWithClient(ctx context.Context, client *Client) context.Context {
+	return context.WithValue(ctx, clientContextKey{}, client)
+}
+
+// ClientFromContext Returns the client stored in ctx by ContextWithClient, ok is false when there is none
+func ClientFromContext(ctx context.Context) (client *Client, ok bool) {
+	client, ok = ctx.Value(clientContextKey{}).(*Client)
+	return client, ok && client != nil
+}
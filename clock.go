@@ -0,0 +1,31 @@
+package avidbase
+
+import "time"
+
+// Clock Tells the time and waits on behalf of a client, for the machine access token expiry, the user cache and
+// the delays between retries. Tests can set a fake clock using WithClock to control time dependent behaviour
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// WithClock Makes the client read the time and wait using the given clock instead of the real one
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		if clock == nil {
+			clock = realClock{}
+		}
+		o.clock = clock
+	}
+}
+
+// realClock The default clock, using the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
@@ -0,0 +1,55 @@
+package avidbase
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+)
+
+// Codec Encodes the request bodies and decodes the response bodies of the api calls, allowing a faster json
+// library such as jsoniter or go-json to be used in place of encoding/json
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// WithJSONCodec Uses the given codec for the request and response bodies, encoding/json is used by default
+func WithJSONCodec(codec Codec) Option {
+	return func(o *options) {
+		if codec == nil {
+			codec = stdCodec{}
+		}
+		o.codec = codec
+	}
+}
+
+// stdCodec The default codec, using encoding/json
+type stdCodec struct{}
+
+func (stdCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (stdCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// decode Reads a response body, up to the maximum response size, and decodes it into out using the codec
+// of the client. io.EOF is returned for an empty body, leaving out untouched
+func (c *Client) decode(body io.Reader, out interface{}) error {
+	data, err := ioutil.ReadAll(c.limitBody(body))
+	if err != nil {
+		return err
+	}
+	return c.unmarshal(data, out)
+}
+
+// unmarshal Decodes a response body already read into out using the codec of the client.
+// io.EOF is returned for an empty body, leaving out untouched
+func (c *Client) unmarshal(data []byte, out interface{}) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return io.EOF
+	}
+	return c.config.codec.Unmarshal(data, out)
+}
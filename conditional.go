@@ -0,0 +1,73 @@
+package avidbase
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// UpdateUserIf Update an existing user using user id and machine access token, only if the fields of the user
+// still have the expected values. expect maps json field names to their expected value, e.g. {"country": "FR"},
+// fields of the data of the user being named by a path such as "data.status".
+// The user is read, checked and updated under its ETag: the call fails with an error matching ErrConflict when
+// an expectation does not hold or the user changed between the check and the update. The api not sending an
+// ETag, the update is made without the guarantee that the user did not change after the check
+func (c *Client) UpdateUserIf(userId string, expect map[string]interface{}, changes User, opts ...CallOption) (identity Identity, err error) {
+	var current map[string]interface{}
+	var meta ResponseMeta
+	getOpts := append(append([]CallOption{}, opts...), WithResponseMeta(&meta))
+	_, err = c.machineRequest("GET", "v1/user/"+userId, nil, nil, &current, "get user", getOpts)
+	if err != nil {
+		return
+	}
+
+	for field, expected := range expect {
+		actual, _ := fieldValue(current, field)
+		if !sameJSON(actual, expected) {
+			err = fmt.Errorf("%w: %s is %v, expected %v", ErrConflict, field, actual, expected)
+			return
+		}
+	}
+
+	updateOpts := append([]CallOption{}, opts...)
+	if meta.ETag != "" {
+		updateOpts = append(updateOpts, WithIfMatch(meta.ETag))
+	}
+	return c.UpdateUser(userId, changes, updateOpts...)
+}
+
+// UpdateUserIf Update an existing user using user id and machine access token with the default client,
+// only if the fields of the user still have the expected values
+func UpdateUserIf(userId string, expect map[string]interface{}, changes User, opts ...CallOption) (identity Identity, err error) {
+	return getDefaultClient().UpdateUserIf(userId, expect, changes, opts...)
+}
+
+// fieldValue Returns the value of the given dot separated path in a decoded json object, ok is false if absent
+func fieldValue(object map[string]interface{}, path string) (value interface{}, ok bool) {
+	value = object
+	for _, key := range strings.Split(path, ".") {
+		nested, isObject := value.(map[string]interface{})
+		if !isObject {
+			return nil, false
+		}
+		if value, ok = nested[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// sameJSON Reports whether a decoded json value equals the expected value once encoded to json, so that e.g.
+// the expected int 1 matches the decoded float64 1
+func sameJSON(actual, expected interface{}) bool {
+	data, err := json.Marshal(expected)
+	if err != nil {
+		return false
+	}
+	var normalized interface{}
+	if json.Unmarshal(data, &normalized) != nil {
+		return false
+	}
+	return reflect.DeepEqual(actual, normalized)
+}
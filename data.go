@@ -0,0 +1,20 @@
+package avidbase
+
+import "time"
+
+// GetTime Returns the timestamp stored under the given key of the data of the user, parsed as RFC3339, RFC3339
+// with fractional seconds, or else using the given layouts in order, e.g. "2006-01-02" for the dates some fields
+// hold. ok is false when the key is missing, its value is not a string or none of the layouts matches
+func (i Identity) GetTime(key string, layouts ...string) (t time.Time, ok bool) {
+	value, isString := i.Data[key].(string)
+	if !isString {
+		return time.Time{}, false
+	}
+
+	for _, layout := range append([]string{time.RFC3339, time.RFC3339Nano}, layouts...) {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,64 @@
+package avidbase
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// DiagnoseResult Reports separately whether the api could be reached and whether it accepted the api key
+type DiagnoseResult struct {
+	// Reachable Whether the api answered the call, whatever the answer
+	Reachable bool
+	// NetworkError The failure to reach the api, such as a DNS lookup or connection failure, use errors.As with
+	// *net.DNSError or *net.OpError for the details. nil when the api answered
+	NetworkError error
+	// Authenticated Whether the api accepted the api key and issued a machine access token
+	Authenticated bool
+	// AuthError The reason the api did not issue a machine access token, matching ErrUnauthorized when the api key
+	// was rejected. nil when authenticated or when the api could not be reached
+	AuthError error
+	// Err The failure that stopped the check without telling about the api, such as ErrClientClosed or an error
+	// returned by a WithBeforeRequest or WithAfterResponse hook. nil when the check ran
+	Err error
+}
+
+// Diagnose Checks the connectivity to the api and the validity of the api key using a single machine access token
+// request, telling apart an unreachable api from a rejected api key, e.g. for readiness checks.
+// The cached machine access token is neither used nor replaced
+func (c *Client) Diagnose() (result DiagnoseResult) {
+	_, _, err := c.fetchMachineAccessToken(context.Background())
+	if err == nil {
+		result.Reachable = true
+		result.Authenticated = true
+		return
+	}
+
+	var apiErr *APIError
+	var hookErr *hookError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &apiErr), errors.Is(err, errAccessTokenMissing):
+		result.Reachable = true
+		result.AuthError = err
+	case errors.As(err, &hookErr):
+		// An after response hook fails once the api answered, a before request hook stops the call beforehand
+		result.Reachable = hookErr.afterResponse
+		result.Err = hookErr.err
+	case errors.As(err, &netErr):
+		result.NetworkError = err
+	case c.accountId == nil || c.getAPIKey() == nil:
+		// No call was made without credentials, the api may or may not be reachable
+		result.AuthError = err
+	default:
+		// No request was sent, e.g. on a closed client
+		result.Err = err
+	}
+
+	return
+}
+
+// Diagnose Checks the connectivity to the api and the validity of the api key with the default client
+func Diagnose() DiagnoseResult {
+	return getDefaultClient().Diagnose()
+}
@@ -0,0 +1,58 @@
+package avidbase
+
+import "reflect"
+
+// DiffIdentities Returns the fields that differ between two versions of a user, keyed by their json name, with
+// their old and new values, e.g. {"email": {"old@example.com", "new@example.com"}}. The custom data is compared key
+// by key at any depth, a changed key being reported as "data.key" or "data.parent.key", a missing key as nil
+func DiffIdentities(old, new Identity) map[string][2]interface{} {
+	diff := make(map[string][2]interface{})
+
+	fields := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"id", old.ID, new.ID},
+		{"first_name", old.FirstName, new.FirstName},
+		{"last_name", old.LastName, new.LastName},
+		{"username", old.Username, new.Username},
+		{"email", old.Email, new.Email},
+		{"country", old.Country, new.Country},
+		{"roles", old.Roles, new.Roles},
+		{"groups", old.Groups, new.Groups},
+		{"status", old.Status, new.Status},
+		{"deleted_at", old.DeletedAt, new.DeletedAt},
+	}
+	for _, field := range fields {
+		if !reflect.DeepEqual(field.old, field.new) {
+			diff[field.name] = [2]interface{}{field.old, field.new}
+		}
+	}
+
+	diffData("data", old.Data, new.Data, diff)
+	return diff
+}
+
+// diffData Adds the keys that differ between two custom data maps to diff, prefixed by path
+func diffData(path string, old, new map[string]interface{}, diff map[string][2]interface{}) {
+	for key, oldValue := range old {
+		newValue, ok := new[key]
+		if !ok {
+			diff[path+"."+key] = [2]interface{}{oldValue, nil}
+			continue
+		}
+
+		oldMap, oldIsMap := oldValue.(map[string]interface{})
+		newMap, newIsMap := newValue.(map[string]interface{})
+		if oldIsMap && newIsMap {
+			diffData(path+"."+key, oldMap, newMap, diff)
+		} else if !reflect.DeepEqual(oldValue, newValue) {
+			diff[path+"."+key] = [2]interface{}{oldValue, newValue}
+		}
+	}
+	for key, newValue := range new {
+		if _, ok := old[key]; !ok {
+			diff[path+"."+key] = [2]interface{}{nil, newValue}
+		}
+	}
+}
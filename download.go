@@ -0,0 +1,45 @@
+package avidbase
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ErrExportNotReady Matches, using errors.Is, the error of DownloadUserData while the api is still preparing the
+// export. The export is prepared asynchronously, retry the download later
+var ErrExportNotReady = errors.New("user data export not ready")
+
+// DownloadUserData Download the data export of an existing user, e.g. to answer a data subject access request,
+// using user id and machine access token. The export is streamed to w as sent by the api, without being held in memory
+// nor limited by WithMaxResponseBytes. Fails with an error matching ErrExportNotReady while the export is being
+// prepared and ErrUserNotFound when the user does not exist
+func (c *Client) DownloadUserData(userId string, w io.Writer, opts ...CallOption) (err error) {
+	// A 202 Accepted answers while the export is being prepared, the content is not available yet
+	accepted := false
+	target := &streamTarget{read: func(resp *http.Response) (err error) {
+		if resp.StatusCode == http.StatusAccepted {
+			accepted = true
+			return
+		}
+		_, err = io.Copy(w, resp.Body)
+		return
+	}}
+	_, err = c.machineRequest("GET", "v1/user/"+userId+"/export", nil, nil, target, "download user data", opts)
+	markAPIError(err, http.StatusNotFound, ErrUserNotFound)
+	if err == nil && accepted {
+		err = &APIError{
+			Method:     "GET",
+			Path:       "v1/user/" + userId + "/export",
+			StatusCode: http.StatusAccepted,
+			Message:    "user data export not ready",
+			sentinel:   ErrExportNotReady,
+		}
+	}
+	return
+}
+
+// DownloadUserData Download the data export of an existing user using user id and machine access token with the default client
+func DownloadUserData(userId string, w io.Writer, opts ...CallOption) (err error) {
+	return getDefaultClient().DownloadUserData(userId, w, opts...)
+}
@@ -0,0 +1,36 @@
+package avidbase
+
+import "net/http"
+
+// RequestEmailChange Starts changing the email of an existing user using user id and machine access token.
+// The api sends a confirmation link holding a token to the new email, the email only changes once the token
+// is passed to ConfirmEmailChange. Fails with an error matching ErrEmailInUse when another user has the new email
+func (c *Client) RequestEmailChange(userId, newEmail string, opts ...CallOption) (err error) {
+	values := map[string]string{"email": newEmail}
+	_, err = c.machineRequest("POST", "v1/user/"+userId+"/email_change", nil, values, nil, "request email change", opts)
+	markAPIError(err, http.StatusConflict, ErrEmailInUse)
+	return
+}
+
+// RequestEmailChange Starts changing the email of an existing user with the default client
+func RequestEmailChange(userId, newEmail string, opts ...CallOption) (err error) {
+	return getDefaultClient().RequestEmailChange(userId, newEmail, opts...)
+}
+
+// ConfirmEmailChange Completes an email change started by RequestEmailChange using the token sent to the new email
+// and machine access token. Fails with an error matching ErrEmailInUse when another user took the email meanwhile
+func (c *Client) ConfirmEmailChange(token string, opts ...CallOption) (err error) {
+	values := map[string]string{"token": token}
+	_, err = c.machineRequest("POST", "v1/user/email_change:confirm", nil, values, nil, "confirm email change", opts)
+	if err == nil {
+		// The token does not tell which user changed, none of the cached users can be trusted
+		c.users.clear()
+	}
+	markAPIError(err, http.StatusConflict, ErrEmailInUse)
+	return
+}
+
+// ConfirmEmailChange Completes an email change using the token sent to the new email with the default client
+func ConfirmEmailChange(token string, opts ...CallOption) (err error) {
+	return getDefaultClient().ConfirmEmailChange(token, opts...)
+}
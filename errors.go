@@ -0,0 +1,239 @@
+package avidbase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrMissingAccount Returned by Init and NewClient when the account id or the api key is empty
+var ErrMissingAccount = errors.New("account id or api key is missing")
+
+// ErrAlreadyInitialized Returned by Init when the default client was already configured by a previous Init,
+// see Reinit
+var ErrAlreadyInitialized = errors.New("avidbase is already initialized, call Reinit to replace the configuration")
+
+// ErrNotInitialized Returned by the calls of the default client made before Init configured an account
+var ErrNotInitialized = errors.New("avidbase is not initialized, call Init with an account and an api key first")
+
+// ErrMissingCredentials Returned by Login when the email/username or the password is empty
+var ErrMissingCredentials = errors.New("email/username or password is missing")
+
+// ErrInvalidMFACode Matches, using errors.Is, the APIError of an mfa call rejected because of a wrong or expired code
+var ErrInvalidMFACode = errors.New("invalid mfa code")
+
+// ErrUserNotFound Matches, using errors.Is, the APIError of a call naming a user that does not exist
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrGroupNotFound Matches, using errors.Is, the APIError of a call naming a group that does not exist
+var ErrGroupNotFound = errors.New("group not found")
+
+// ErrMFARequired Returned by Login for users with two-factor authentication, see LoginWithMFA
+var ErrMFARequired = errors.New("two-factor authentication required")
+
+// ErrNoPermissions Returned by Login and LoginWithMFA configured by WithRequirePermissions when the api grants
+// the user no permission
+var ErrNoPermissions = errors.New("login returned no permissions")
+
+// ErrConflict Matches the error of a conditional call, made with WithIfMatch or UpdateUserIf, on a user changed since
+// it was read
+var ErrConflict = errors.New("conflict, the resource was changed")
+
+// ErrTooManyRedirects Returned when a call is redirected more often than allowed by WithMaxRedirects
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// ErrReadOnly Returned by the calls changing data made by a client configured by WithReadOnly
+var ErrReadOnly = errors.New("client is read-only")
+
+// ErrClientClosed Returned by the calls of a client after Close
+var ErrClientClosed = errors.New("client is closed")
+
+// ErrUnauthorized Matches, using errors.Is, the APIError of a call rejected because its access token is invalid or expired
+var ErrUnauthorized = errors.New("unauthorized")
+
+// ErrEmailInUse Matches, using errors.Is, the APIError of a call rejected because the email belongs to another user
+var ErrEmailInUse = errors.New("email already in use")
+
+// ErrResponseTooLarge Returned when a response body is larger than the limit set by WithMaxResponseBytes
+var ErrResponseTooLarge = errors.New("response body exceeds the maximum allowed size")
+
+// APIError Returned when the api responds to a call with a non successful status code
+type APIError struct {
+	// Method The http method of the failed call, e.g. "GET"
+	Method string
+	// Path The path of the failed call without its query, e.g. "v1/user/123"
+	Path string
+	// StatusCode The http status code of the response
+	StatusCode int
+	// Message The error message sent by the api
+	Message string
+	// Code The machine readable error code sent by the api, e.g. "email_taken", empty if none was sent.
+	// Prefer it over Message when handling specific errors, it does not change with the wording of the message
+	Code string
+	// RawBody The body of the response as sent by the api, e.g. to log the details of a json error body
+	RawBody []byte
+
+	// sentinel A sentinel error the call identified the failure as, matched by Is
+	sentinel error
+}
+
+func (e *APIError) Error() string {
+	return e.Method + " " + e.Path + " failed: " + e.Message + ", status code: " + strconv.Itoa(e.StatusCode)
+}
+
+// Is Lets errors.Is match the api error against the sentinel errors of its status code, e.g. ErrUnauthorized
+func (e *APIError) Is(target error) bool {
+	if e.sentinel != nil && e.sentinel == target {
+		return true
+	}
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrEmailInUse:
+		return e.Code == "email_taken"
+	case ErrInvalidMFACode:
+		return e.Code == "invalid_mfa_code"
+	case ErrUserNotFound:
+		return e.Code == "user_not_found"
+	case ErrGroupNotFound:
+		return e.Code == "group_not_found"
+	case ErrPasswordRejected:
+		return e.Code == "password_rejected"
+	}
+	return false
+}
+
+// newAPIError Builds the error of a failed response, reading the error message from its body.
+// The message of a json body is read from its "message" or "error" field, other bodies are the message as is.
+// action describes the call when the body can not be read, e.g. "get user"
+func (c *Client) newAPIError(method, path string, resp *http.Response, action string) *APIError {
+	apiErr := &APIError{
+		Method:     method,
+		Path:       path,
+		StatusCode: resp.StatusCode,
+		Message:    action + " failed",
+	}
+
+	errorMessage, readErr := ioutil.ReadAll(c.limitBody(resp.Body))
+	if readErr == nil {
+		apiErr.RawBody = errorMessage
+		apiErr.Message = strings.Trim(string(errorMessage), "\"")
+
+		var body struct {
+			Code string `json:"code"`
+		}
+		if json.Unmarshal(errorMessage, &body) == nil {
+			apiErr.Code = body.Code
+		}
+		if isJSON(resp.Header.Get("Content-Type")) {
+			if message, code := jsonErrorMessage(errorMessage); message != "" {
+				apiErr.Message = message
+				if code != "" {
+					apiErr.Code = code
+				}
+			}
+		}
+	}
+
+	return apiErr
+}
+
+// isJSON Reports whether the given Content-Type is json, e.g. "application/json; charset=utf-8"
+// or "application/problem+json"
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// jsonErrorMessage Returns the message of a json error body from its "message" field, or its "error" field holding
+// either the message or an object with the message and the code. The message is empty when there is none
+func jsonErrorMessage(data []byte) (message, code string) {
+	var body struct {
+		Message string          `json:"message"`
+		Error   json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(data, &body) != nil {
+		return "", ""
+	}
+	if body.Message != "" {
+		return body.Message, ""
+	}
+
+	var object struct {
+		Message string `json:"message"`
+		Code    string `json:"code"`
+	}
+	if json.Unmarshal(body.Error, &message) == nil {
+		return message, ""
+	}
+	if json.Unmarshal(body.Error, &object) == nil {
+		return object.Message, object.Code
+	}
+	return "", ""
+}
+
+// WithErrorFieldDetection Fails the calls answered with a successful status code but an "error" field in their
+// json body, e.g. {"error": "user is locked"}, with an APIError holding that error instead of decoding the body
+// as a success. Off by default since it inspects every response body
+func WithErrorFieldDetection() Option {
+	return func(o *options) {
+		o.detectErrorField = true
+	}
+}
+
+// errorField Returns the APIError described by the error field of a successful response body, nil when the body
+// is not a json object with a non empty error field
+func errorField(method, path string, statusCode int, data []byte) *APIError {
+	var body struct {
+		Error json.RawMessage `json:"error"`
+		Code  string          `json:"code"`
+	}
+	if json.Unmarshal(data, &body) != nil {
+		return nil
+	}
+	field := strings.TrimSpace(string(body.Error))
+	if field == "" || field == "null" || field == `""` || field == "false" {
+		return nil
+	}
+
+	apiErr := &APIError{Method: method, Path: path, StatusCode: statusCode, Message: field, Code: body.Code, RawBody: data}
+
+	// The error is either a message or an object holding the message and the code
+	var message string
+	var object struct {
+		Message string `json:"message"`
+		Code    string `json:"code"`
+	}
+	if json.Unmarshal(body.Error, &message) == nil {
+		apiErr.Message = message
+	} else if json.Unmarshal(body.Error, &object) == nil && object.Message != "" {
+		apiErr.Message = object.Message
+		if object.Code != "" {
+			apiErr.Code = object.Code
+		}
+	}
+
+	return apiErr
+}
+
+// markAPIError Makes the APIError in err, if any, match the given sentinel error when it has the given status code
+func markAPIError(err error, statusCode int, sentinel error) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == statusCode {
+		apiErr.sentinel = sentinel
+	}
+}
+
+// callError Builds the error of a call that failed before a response could be used, mentioning the call
+// and wrapping the cause if any
+func callError(method, path, message string, cause error) error {
+	if cause == nil {
+		return errors.New(method + " " + path + " failed: " + message)
+	}
+	return fmt.Errorf("%s %s failed: %s: %w", method, path, message, cause)
+}
@@ -0,0 +1,3 @@
+module github.com/AvidBase/avidbase-sdk-go
+
+go 1.15
@@ -0,0 +1,52 @@
+package avidbase
+
+import "net/http"
+
+// Group A group of users of the account
+type Group struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// GetUserGroups Get the groups of an existing user using user id and machine access token.
+// Fails with an error matching ErrUserNotFound when the user does not exist
+func (c *Client) GetUserGroups(userId string, opts ...CallOption) (groups []Group, err error) {
+	groups = make([]Group, 0)
+	_, err = c.machineRequest("GET", "v1/user/"+userId+"/group", nil, nil, &groups, "get user groups", opts)
+	if groups == nil {
+		groups = make([]Group, 0)
+	}
+	markAPIError(err, http.StatusNotFound, ErrUserNotFound)
+	return
+}
+
+// GetUserGroups Get the groups of an existing user using user id and machine access token with the default client
+func GetUserGroups(userId string, opts ...CallOption) (groups []Group, err error) {
+	return getDefaultClient().GetUserGroups(userId, opts...)
+}
+
+// AddUserToGroup Add an existing user to a group using user id, group id and machine access token.
+// Fails with an error matching ErrUserNotFound or ErrGroupNotFound when the user or the group does not exist
+func (c *Client) AddUserToGroup(userId, groupId string, opts ...CallOption) (err error) {
+	defer c.users.delete(userId)
+	_, err = c.machineRequest("PUT", "v1/user/"+userId+"/group/"+groupId, nil, nil, nil, "add user to group", opts)
+	return
+}
+
+// AddUserToGroup Add an existing user to a group using user id, group id and machine access token with the default client
+func AddUserToGroup(userId, groupId string, opts ...CallOption) (err error) {
+	return getDefaultClient().AddUserToGroup(userId, groupId, opts...)
+}
+
+// RemoveUserFromGroup Remove a user from a group using user id, group id and machine access token.
+// Fails with an error matching ErrUserNotFound or ErrGroupNotFound when the user or the group does not exist
+func (c *Client) RemoveUserFromGroup(userId, groupId string, opts ...CallOption) (err error) {
+	defer c.users.delete(userId)
+	_, err = c.machineRequest("DELETE", "v1/user/"+userId+"/group/"+groupId, nil, nil, nil, "remove user from group", opts)
+	return
+}
+
+// RemoveUserFromGroup Remove a user from a group using user id, group id and machine access token with the default client
+func RemoveUserFromGroup(userId, groupId string, opts ...CallOption) (err error) {
+	return getDefaultClient().RemoveUserFromGroup(userId, groupId, opts...)
+}
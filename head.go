@@ -0,0 +1,36 @@
+package avidbase
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// headRequest Makes a HEAD api call using machine access token, reading the response headers without transferring
+// a body. Routes where the api does not support HEAD, answering 405 or 501, are called again with GET, whose body
+// is discarded
+func (c *Client) headRequest(path string, query url.Values, action string, opts []CallOption) (header http.Header, err error) {
+	header, err = c.machineRequest("HEAD", path, query, nil, nil, action, opts)
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusMethodNotAllowed || apiErr.StatusCode == http.StatusNotImplemented) {
+		header, err = c.machineRequest("GET", path, query, nil, nil, action, opts)
+	}
+	return
+}
+
+// UserExists Check whether a user exists using user id and machine access token, without fetching the user
+func (c *Client) UserExists(userId string, opts ...CallOption) (exists bool, err error) {
+	_, err = c.headRequest("v1/user/"+userId, nil, "check user", opts)
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// UserExists Check whether a user exists using user id and machine access token with the default client
+func UserExists(userId string, opts ...CallOption) (exists bool, err error) {
+	return getDefaultClient().UserExists(userId, opts...)
+}
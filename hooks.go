@@ -0,0 +1,36 @@
+package avidbase
+
+import "net/http"
+
+// WithBeforeRequest Calls the given hook on every outgoing request, including retries and the machine access token
+// generation, just before it is sent. The hook may change the request, e.g. to add a signature header,
+// and returning an error aborts the call with that error. Hooks run in the order they were added
+func WithBeforeRequest(hook func(*http.Request) error) Option {
+	return func(o *options) {
+		o.beforeRequest = append(o.beforeRequest, hook)
+	}
+}
+
+// WithAfterResponse Calls the given hook on every response, including retries and the machine access token
+// generation, before it is decoded. The hook may inspect the status and headers, e.g. to enforce a security header,
+// and returning an error aborts the call with that error. Hooks run in the order they were added
+func WithAfterResponse(hook func(*http.Response) error) Option {
+	return func(o *options) {
+		o.afterResponse = append(o.afterResponse, hook)
+	}
+}
+
+// hookError Wraps the error returned by a hook so that it reaches the caller as is, without being retried
+type hookError struct {
+	err error
+	// afterResponse Whether the api answered before the hook failed
+	afterResponse bool
+}
+
+func (e *hookError) Error() string {
+	return e.err.Error()
+}
+
+func (e *hookError) Unwrap() error {
+	return e.err
+}
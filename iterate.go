@@ -0,0 +1,138 @@
+package avidbase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// UserIterator Iterates over the users of a list, see IterateUsers. It is not safe for concurrent use
+type UserIterator struct {
+	users  chan Identity
+	cancel context.CancelFunc
+
+	user   Identity
+	err    error
+	done   bool
+	closed bool
+}
+
+// IterateUsers Iterates over all the users using machine access token, decoding every page incrementally so that
+// each user is available as soon as it is received instead of once its whole page is. Every page is limited by
+// WithMaxResponseBytes and the users are decoded using the codec set by WithJSONCodec. The page being read does not
+// count against WithMaxConcurrentRequests, so that calls can be made from within the loop. Call Close when stopping
+// before the end of the list:
+//
+//	it := client.IterateUsers()
+//	defer it.Close()
+//	for it.Next() {
+//		user := it.User()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+func (c *Client) IterateUsers(opts ...CallOption) *UserIterator {
+	call := newCallOptions(opts)
+	ctx, cancel := context.WithCancel(call.ctx)
+	it := &UserIterator{users: make(chan Identity), cancel: cancel}
+
+	pageOpts := append(append([]CallOption{}, opts...), WithContext(ctx))
+	go func() {
+		defer close(it.users)
+		it.err = c.walkUserPages(nil, pageOpts, func(q url.Values) (header http.Header, count int, err error) {
+			target := &streamTarget{read: func(resp *http.Response) (err error) {
+				count, err = c.decodeUsers(ctx, resp.Body, func(user Identity) {
+					call.maskUser(&user)
+					select {
+					case it.users <- user:
+					case <-ctx.Done():
+					}
+				})
+				return
+			}}
+			header, err = c.machineRequest("GET", "v1/user", q, nil, target, "list users", pageOpts)
+			return
+		})
+	}()
+	return it
+}
+
+// IterateUsers Iterates over all the users using machine access token with the default client
+func IterateUsers(opts ...CallOption) *UserIterator {
+	return getDefaultClient().IterateUsers(opts...)
+}
+
+// Next Advances to the next user, returning false at the end of the list or when the iteration failed, see Err
+func (it *UserIterator) Next() bool {
+	user, ok := <-it.users
+	if !ok {
+		it.done = true
+		return false
+	}
+	it.user = user
+	return true
+}
+
+// User Returns the user the last call to Next advanced to
+func (it *UserIterator) User() Identity {
+	return it.user
+}
+
+// Err Returns the error that ended the iteration once Next returned false, including an invalid json after
+// the last user of a page. It is nil at the end of the list, after Close and while the iteration goes on
+func (it *UserIterator) Err() error {
+	if !it.done || it.closed {
+		return nil
+	}
+	return it.err
+}
+
+// Close Stops the iteration, cancelling the page being fetched. It is safe to call more than once
+func (it *UserIterator) Close() error {
+	it.closed = true
+	it.cancel()
+	// Wait for the fetching to stop, it does not send any more user once cancelled
+	for range it.users {
+	}
+	it.done = true
+	return nil
+}
+
+// decodeUsers Decodes a json array of users element by element using the codec of the client, calling yield with
+// each of them. An empty body or a json null is an empty array. It stops early when ctx is done and fails with
+// ErrResponseTooLarge once the body exceeds the maximum response size
+func (c *Client) decodeUsers(ctx context.Context, body io.Reader, yield func(user Identity)) (count int, err error) {
+	decoder := json.NewDecoder(c.limitBody(body))
+	token, err := decoder.Token()
+	if err == io.EOF || (err == nil && token == nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return 0, errors.New("expected a json array of users")
+	}
+
+	for decoder.More() {
+		// encoding/json only splits the array, the codec decodes every user
+		var element json.RawMessage
+		if err = decoder.Decode(&element); err != nil {
+			return
+		}
+		var user Identity
+		if err = c.config.codec.Unmarshal(element, &user); err != nil {
+			return
+		}
+		count++
+		yield(user)
+		if err = ctx.Err(); err != nil {
+			return
+		}
+	}
+	// Read the end of the array so that a truncated or invalid body is reported
+	_, err = decoder.Token()
+	return
+}
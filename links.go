@@ -0,0 +1,43 @@
+package avidbase
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// pageLinks Returns the page tokens of the next and prev links of an RFC 5988 Link header, e.g.
+// `<https://api.avidbase.com/v1/user?limit=100&offset=200>; rel="next"`. A page token is the query of the link,
+// empty when the link is missing or malformed
+func pageLinks(header http.Header) (next, prev string) {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			linkUrl, err := url.Parse(target[1 : len(target)-1])
+			if err != nil {
+				continue
+			}
+
+			for _, param := range parts[1:] {
+				nameValue := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(nameValue) != 2 || strings.ToLower(strings.TrimSpace(nameValue[0])) != "rel" {
+					continue
+				}
+				// A link may have several space separated relations, e.g. rel="next last"
+				for _, rel := range strings.Fields(strings.Trim(nameValue[1], `"`)) {
+					switch strings.ToLower(rel) {
+					case "next":
+						next = linkUrl.RawQuery
+					case "prev", "previous":
+						prev = linkUrl.RawQuery
+					}
+				}
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,164 @@
+package avidbase
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Logger Receives the logs of the sdk, *slog.Logger satisfies it
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+}
+
+// defaultMaxBodyLogBytes The number of bytes of every body logged, unless set by WithMaxBodyLogBytes
+const defaultMaxBodyLogBytes = 4 << 10
+
+// redacted Replaces the values of sensitive keys in logged bodies
+const redacted = "[REDACTED]"
+
+// defaultRedactKeys The json keys always redacted from logged bodies
+var defaultRedactKeys = []string{"password", "api_key", "access_token", "Access-Token", "challenge_token", "token"}
+
+// requestRedactKeys The json keys also redacted from logged request bodies, e.g. the mfa code, which responses
+// use for the machine readable error codes
+var requestRedactKeys = []string{"code"}
+
+// WithLogger Logs every request and response, with their bodies, at debug level to the given logger.
+// The values of sensitive json keys are redacted from the bodies, see WithRedactKeys, and the api key is never logged
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithRedactKeys Redacts the given json keys, matched case insensitively at any depth, from the logged bodies
+// in addition to password, api_key, access tokens, the mfa challenge token, the email change token and, in request
+// bodies only, the mfa code
+func WithRedactKeys(keys ...string) Option {
+	return func(o *options) {
+		o.redactKeys = append(o.redactKeys, keys...)
+	}
+}
+
+// logRequest Logs the request and its body when a logger is set
+func (c *Client) logRequest(req *http.Request) {
+	if c.config.logger == nil {
+		return
+	}
+
+	var reqBody []byte
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			reqBody, _ = ioutil.ReadAll(body)
+			body.Close()
+		}
+	}
+	c.config.logger.Debug("avidbase request", "method", req.Method, "path", req.URL.Path, "body", c.truncate(c.redact(reqBody, requestRedactKeys...)))
+}
+
+// logResponse Logs the response and its body when a logger is set, or the error if the call failed
+func (c *Client) logResponse(req *http.Request, resp *http.Response, err error) {
+	if c.config.logger == nil {
+		return
+	}
+	if err != nil {
+		c.config.logger.Debug("avidbase request failed", "method", req.Method, "path", req.URL.Path, "error", err)
+		return
+	}
+	if isStreamed(req) && isSuccess(resp.StatusCode) {
+		c.config.logger.Debug("avidbase response", "method", req.Method, "path", req.URL.Path,
+			"status", resp.StatusCode, "body", "[streamed]")
+		return
+	}
+
+	// Read the body for logging and hand an identical copy to the caller
+	respBody, readErr := ioutil.ReadAll(c.limitBody(resp.Body))
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	if readErr != nil {
+		resp.Body = ioutil.NopCloser(&errorReader{err: readErr})
+	}
+	c.config.logger.Debug("avidbase response", "method", req.Method, "path", req.URL.Path,
+		"status", resp.StatusCode, "body", c.truncate(c.redact(respBody)))
+}
+
+// WithMaxBodyLogBytes Limits how much of every body is logged to n bytes, the rest being replaced by a truncation
+// marker telling the full size. Defaults to 4KB, 0 logs the bodies entirely
+func WithMaxBodyLogBytes(n int) Option {
+	return func(o *options) {
+		if n < 0 {
+			n = 0
+		}
+		o.maxBodyLogBytes = n
+	}
+}
+
+// truncate Shortens a logged body to the limit set by WithMaxBodyLogBytes, without splitting a character
+func (c *Client) truncate(body string) string {
+	limit := c.config.maxBodyLogBytes
+	if limit == 0 || len(body) <= limit {
+		return body
+	}
+	for limit > 0 && !utf8.RuneStart(body[limit]) {
+		limit--
+	}
+	return body[:limit] + "... [truncated, " + strconv.Itoa(len(body)) + " bytes in total]"
+}
+
+// redact Returns the body with the values of the sensitive keys, and of the given extra keys, replaced
+func (c *Client) redact(body []byte, extraKeys ...string) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err == nil {
+		keys := append(append(append([]string(nil), defaultRedactKeys...), extraKeys...), c.config.redactKeys...)
+		if redactedBody, err := json.Marshal(redactValue(value, keys)); err == nil {
+			body = redactedBody
+		}
+	}
+
+	// Never let the api key through, even in a body that could not be parsed
+	text := string(body)
+	if key := StringValue(c.getAPIKey()); key != "" {
+		text = strings.ReplaceAll(text, key, redacted)
+	}
+	return text
+}
+
+// redactValue Replaces the values of the given keys in a json decoded value
+func redactValue(value interface{}, keys []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, item := range v {
+			v[name] = redactValue(item, keys)
+			for _, key := range keys {
+				if strings.EqualFold(name, key) {
+					v[name] = redacted
+					break
+				}
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item, keys)
+		}
+	}
+	return value
+}
+
+// errorReader Fails every read with the error met while reading the original body
+type errorReader struct {
+	err error
+}
+
+func (r *errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,74 @@
+package avidbase
+
+import (
+	"errors"
+	"net/http"
+)
+
+// mfaChallengeHeader The response header holding the challenge token of a login requiring two-factor authentication
+const mfaChallengeHeader = "MFA-Challenge-Token"
+
+// EnrollMFA Starts enrolling the user owning the given user access token in TOTP two-factor authentication.
+// The secret, or the otpauth url usually shown as a QR code, is added to the user's authenticator app, the enrollment
+// only completes once VerifyMFA confirms a code generated by that app
+func (c *Client) EnrollMFA(accessToken string, opts ...CallOption) (secret string, otpauthURL string, err error) {
+	if accessToken == "" {
+		err = errors.New("access token is missing")
+		return
+	}
+
+	var output struct {
+		Secret     string `json:"secret"`
+		OTPAuthURL string `json:"otpauth_url"`
+	}
+	opts = append(opts[:len(opts):len(opts)], WithAccessToken(accessToken))
+	_, err = c.machineRequest("POST", "v1/auth/mfa", nil, nil, &output, "enroll mfa", opts)
+	if err != nil {
+		return
+	}
+
+	return output.Secret, output.OTPAuthURL, nil
+}
+
+// EnrollMFA Starts enrolling the user owning the given user access token in TOTP two-factor authentication with the default client
+func EnrollMFA(accessToken string, opts ...CallOption) (secret string, otpauthURL string, err error) {
+	return getDefaultClient().EnrollMFA(accessToken, opts...)
+}
+
+// VerifyMFA Completes the enrollment started by EnrollMFA using a code generated by the user's authenticator app
+// and the user access token. Fails with an error matching ErrInvalidMFACode when the code is wrong or expired,
+// the user may then retry with a new code
+func (c *Client) VerifyMFA(accessToken, code string, opts ...CallOption) (err error) {
+	return c.mfaCodeRequest("v1/auth/mfa:verify", accessToken, code, "verify mfa", opts)
+}
+
+// VerifyMFA Completes the enrollment started by EnrollMFA with the default client
+func VerifyMFA(accessToken, code string, opts ...CallOption) (err error) {
+	return getDefaultClient().VerifyMFA(accessToken, code, opts...)
+}
+
+// DisableMFA Turns off the two-factor authentication of the user owning the given user access token, a current
+// code from the user's authenticator app proving the request. Fails with an error matching ErrInvalidMFACode when
+// the code is wrong or expired
+func (c *Client) DisableMFA(accessToken, code string, opts ...CallOption) (err error) {
+	return c.mfaCodeRequest("v1/auth/mfa:disable", accessToken, code, "disable mfa", opts)
+}
+
+// DisableMFA Turns off the two-factor authentication of the user owning the given user access token with the default client
+func DisableMFA(accessToken, code string, opts ...CallOption) (err error) {
+	return getDefaultClient().DisableMFA(accessToken, code, opts...)
+}
+
+// mfaCodeRequest Sends an mfa code to the given path using the user access token
+func (c *Client) mfaCodeRequest(path, accessToken, code, action string, opts []CallOption) (err error) {
+	if accessToken == "" || code == "" {
+		err = errors.New("access token or mfa code is missing")
+		return
+	}
+
+	values := map[string]string{"code": code}
+	opts = append(opts[:len(opts):len(opts)], WithAccessToken(accessToken))
+	_, err = c.machineRequest("POST", path, nil, values, nil, action, opts)
+	markAPIError(err, http.StatusUnprocessableEntity, ErrInvalidMFACode)
+	return
+}
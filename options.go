@@ -0,0 +1,289 @@
+package avidbase
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Option Configures the optional behaviour of a client when passed to NewClient or Init
+type Option func(*options)
+
+type options struct {
+	baseUrl string
+
+	timeout      time.Duration
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	listTimeout  time.Duration
+
+	maxAttempts   int
+	retryDelay    time.Duration
+	maxBackoff    time.Duration
+	retryDeadline time.Duration
+	jitter        Jitter
+
+	retryableStatusCodes []int
+	retryPredicate       func(*http.Response, error) bool
+
+	requestIdKey      interface{}
+	generateRequestId bool
+
+	batchConcurrency      int
+	pageSize              int
+	maxConcurrentRequests int
+
+	minTLSVersion       uint16
+	maxResponseBytes    int64
+	dialTimeout         time.Duration
+	tlsHandshakeTimeout time.Duration
+	headerTimeout       time.Duration
+	transport           http.RoundTripper
+	disableKeepAlives   bool
+	insecureSkipVerify  bool
+	maxRedirects        int
+
+	dataSchema    *dataSchema
+	dataSchemaErr error
+
+	minPasswordLength int
+
+	codec            Codec
+	detectErrorField bool
+
+	userCacheTTL        time.Duration
+	userCacheMaxEntries int
+
+	usernameNormalization usernameNormalization
+
+	clock Clock
+
+	defaultCountry string
+
+	readOnly           bool
+	requirePermissions bool
+
+	tokenCache *TokenCache
+
+	logger          Logger
+	maxBodyLogBytes int
+	redactKeys      []string
+
+	tracer            Tracer
+	spanNameFormatter func(method, path string) string
+
+	beforeRequest []func(*http.Request) error
+	afterResponse []func(*http.Response) error
+
+	onTokenRefresh func(expiry time.Time)
+	onRetry        func(RetryInfo)
+
+	language string
+
+	hostHeader      string
+	userAgentSuffix string
+
+	authHeader       string
+	authHeaderPrefix string
+}
+
+// defaultOptions Returns the options of a client created without any
+func defaultOptions() options {
+	return options{
+		retryDelay: 500 * time.Millisecond,
+		jitter:     JitterFull,
+
+		batchConcurrency: 8,
+		pageSize:         defaultPageSize,
+
+		minPasswordLength: defaultMinPasswordLength,
+
+		maxBodyLogBytes: defaultMaxBodyLogBytes,
+
+		codec: stdCodec{},
+		clock: realClock{},
+
+		minTLSVersion:       tls.VersionTLS12,
+		maxResponseBytes:    32 << 20,
+		dialTimeout:         30 * time.Second,
+		tlsHandshakeTimeout: 10 * time.Second,
+		maxRedirects:        defaultMaxRedirects,
+	}
+}
+
+// WithRetry Retries transient failures (network errors, 429 and 5xx responses) up to maxAttempts in total,
+// waiting an exponentially growing delay starting at baseDelay between the attempts.
+// Non idempotent calls such as creating a user are only retried when the server asks to slow down (429), unless
+// given WithIdempotencyKey: they are then retried like the others, which is only safe if the api honours the key
+func WithRetry(maxAttempts int, baseDelay time.Duration) Option {
+	return func(o *options) {
+		if maxAttempts < 1 {
+			maxAttempts = 1
+		}
+		o.maxAttempts = maxAttempts
+		o.retryDelay = baseDelay
+	}
+}
+
+// WithRetryDeadline Retries transient failures, as WithRetry does, as long as the time spent on the call including
+// the backoff delays stays within d, then returns the last error. Combined with WithRetry the call stops at whichever
+// of the attempts or the deadline runs out first, alone the number of attempts is unbounded
+func WithRetryDeadline(d time.Duration) Option {
+	return func(o *options) {
+		o.retryDeadline = d
+	}
+}
+
+// WithMaxBackoff Caps the delay waited between two attempts of a call, which otherwise doubles with every retry,
+// e.g. to keep interactive calls responsive. The jitter applies within the cap. No cap by default
+func WithMaxBackoff(d time.Duration) Option {
+	return func(o *options) {
+		o.maxBackoff = d
+	}
+}
+
+// canRetry Reports whether another attempt may follow the given attempt, not accounting for the retry deadline
+func (o options) canRetry(attempt int) bool {
+	if o.maxAttempts > 0 {
+		return attempt < o.maxAttempts
+	}
+	return o.retryDeadline > 0
+}
+
+// retriesEnabled Reports whether failed calls may be retried
+func (o options) retriesEnabled() bool {
+	return o.canRetry(1)
+}
+
+// WithRetryableStatusCodes Replaces the response status codes retried by WithRetry and WithRetryDeadline, 429 and
+// 5xx by default, with the given ones. Calls that are not idempotent, such as creating a user without
+// WithIdempotencyKey, are still only retried on 429, which tells that the api did not process the call,
+// even when the given codes include server errors
+func WithRetryableStatusCodes(statusCodes ...int) Option {
+	return func(o *options) {
+		o.retryableStatusCodes = append(make([]int, 0, len(statusCodes)), statusCodes...)
+	}
+}
+
+// WithRetryPredicate Makes the given function decide whether a failed attempt is retried, overriding the default
+// decision based on the status code, WithRetryableStatusCodes and the idempotency of the call. It is called after
+// every attempt with either the response, whose body it may read, or the transport error. The number of attempts
+// and the delays are still set by WithRetry or WithRetryDeadline. Retrying calls that are not idempotent is left
+// to the predicate, e.g. by checking resp.Request.Method. The successful responses of the calls streaming their body,
+// such as DownloadUserData, are not passed to it and never retried
+func WithRetryPredicate(predicate func(resp *http.Response, err error) bool) Option {
+	return func(o *options) {
+		o.retryPredicate = predicate
+	}
+}
+
+// WithJitter Sets how the retry backoff delay is randomized, defaults to JitterFull
+func WithJitter(jitter Jitter) Option {
+	return func(o *options) {
+		o.jitter = jitter
+	}
+}
+
+// WithBatchConcurrency Sets how many calls the batch helpers such as DeleteUsers make at the same time, defaults to 8
+func WithBatchConcurrency(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.batchConcurrency = n
+		}
+	}
+}
+
+// WithBaseURL Sends the api calls to the given url instead of the production or development api,
+// e.g. to a proxy or to a fake server in tests
+func WithBaseURL(baseUrl string) Option {
+	return func(o *options) {
+		if baseUrl != "" && !strings.HasSuffix(baseUrl, "/") {
+			baseUrl += "/"
+		}
+		o.baseUrl = baseUrl
+	}
+}
+
+// WithOnTokenRefresh Calls the given function every time a new machine access token is generated, with the expiry
+// sent by the api or the zero time if none was sent. Useful to count refreshes and detect premature expiries
+func WithOnTokenRefresh(onTokenRefresh func(expiry time.Time)) Option {
+	return func(o *options) {
+		o.onTokenRefresh = onTokenRefresh
+	}
+}
+
+// WithOnRetry Calls the given function before waiting for every retry, e.g. to monitor the time spent in backoff.
+// Retries are also logged at warn level to the logger set by WithLogger
+func WithOnRetry(onRetry func(info RetryInfo)) Option {
+	return func(o *options) {
+		o.onRetry = onRetry
+	}
+}
+
+// WithPageSize Sets how many users are requested per page when the list calls page through all the users,
+// trading fewer larger requests against memory. Clamped to the api maximum of 1000, defaults to 100
+func WithPageSize(n int) Option {
+	return func(o *options) {
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+		if n > 0 {
+			o.pageSize = n
+		}
+	}
+}
+
+// WithMaxConcurrentRequests Limits how many requests of the client, across all goroutines and including the batch
+// helpers, are in flight at the same time. Requests beyond the limit wait for a free slot or for their context to be done
+func WithMaxConcurrentRequests(n int) Option {
+	return func(o *options) {
+		o.maxConcurrentRequests = n
+	}
+}
+
+// WithLanguage Sends the given language tag, e.g. "fr" or "pt-BR", as the Accept-Language header of every request
+// so that the api localizes its messages, validation errors included. By default no header is sent
+func WithLanguage(tag string) Option {
+	return func(o *options) {
+		o.language = tag
+	}
+}
+
+// WithHostHeader Sends the given host as the Host header of every request, the machine access token generation
+// included, while still connecting to the base url, e.g. to route through a load balancer
+func WithHostHeader(host string) Option {
+	return func(o *options) {
+		o.hostHeader = host
+	}
+}
+
+// WithDefaultCountry Sets the country, e.g. "FR", of the users created by CreateUser without a country.
+// A country given to CreateUser always takes precedence
+func WithDefaultCountry(code string) Option {
+	return func(o *options) {
+		o.defaultCountry = code
+	}
+}
+
+// WithReadOnly Makes the calls that change data, such as CreateUser, UpdateUser or DeleteUser, fail with ErrReadOnly
+// without reaching the api, e.g. as a guardrail for a reporting service. Every POST, PUT, PATCH and DELETE call
+// is refused, including the revocation of the token of VerifyCredentials, while Login and the reads work normally
+func WithReadOnly(readOnly bool) Option {
+	return func(o *options) {
+		o.readOnly = readOnly
+	}
+}
+
+// WithAuthHeader Sends the access token of the calls in the given header, preceded by valuePrefix and a space, e.g.
+// WithAuthHeader("Authorization", "Bearer") for gateways expecting OAuth style headers.
+// By default the token is sent as is in the Access-Token header
+func WithAuthHeader(name, valuePrefix string) Option {
+	return func(o *options) {
+		o.authHeader = name
+		o.authHeaderPrefix = valuePrefix
+		if valuePrefix != "" && !strings.HasSuffix(valuePrefix, " ") {
+			o.authHeaderPrefix += " "
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package avidbase
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// defaultMinPasswordLength The minimum password length checked by CreateUser, unless set by WithMinPasswordLength
+const defaultMinPasswordLength = 8
+
+// ErrPasswordTooShort Returned by CreateUser and SetUserPassword, before making the call, when the password is shorter than the
+// length set by WithMinPasswordLength
+var ErrPasswordTooShort = errors.New("password is too short")
+
+// ErrPasswordRejected Matches, using errors.Is, the APIError of a call setting a password the password policy
+// of the account rejects, e.g. one too weak or used before
+var ErrPasswordRejected = errors.New("password rejected by the password policy")
+
+// WithMinPasswordLength Sets the minimum number of characters of the password given to CreateUser and
+// SetUserPassword, 8 by default.
+// A length of 0 disables the check, leaving the validation of passwords to the api
+func WithMinPasswordLength(length int) Option {
+	return func(o *options) {
+		if length < 0 {
+			length = 0
+		}
+		o.minPasswordLength = length
+	}
+}
+
+// validatePassword Checks the given password, if any, against the minimum password length of the client
+func (c *Client) validatePassword(password *string) error {
+	if password == nil || c.config.minPasswordLength == 0 {
+		return nil
+	}
+	if len([]rune(*password)) < c.config.minPasswordLength {
+		return fmt.Errorf("%w, it must be at least %d characters long", ErrPasswordTooShort, c.config.minPasswordLength)
+	}
+	return nil
+}
+
+// SetUserPassword Set the password of an existing user using user id and machine access token, e.g. for an admin
+// to reset it. Fails with ErrPasswordTooShort before making the call, with an error matching ErrPasswordRejected when
+// the password policy of the account rejects the password and ErrUserNotFound when the user does not exist
+func (c *Client) SetUserPassword(userId, newPassword string, opts ...CallOption) (err error) {
+	if err = c.validatePassword(&newPassword); err != nil {
+		return
+	}
+
+	values := map[string]string{"password": newPassword}
+	_, err = c.machineRequest("PUT", "v1/user/"+userId+"/password", nil, values, nil, "set user password", opts)
+	markAPIError(err, http.StatusUnprocessableEntity, ErrPasswordRejected)
+	markAPIError(err, http.StatusNotFound, ErrUserNotFound)
+	return
+}
+
+// SetUserPassword Set the password of an existing user using user id and machine access token with the default client
+func SetUserPassword(userId, newPassword string, opts ...CallOption) (err error) {
+	return getDefaultClient().SetUserPassword(userId, newPassword, opts...)
+}
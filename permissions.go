@@ -0,0 +1,38 @@
+package avidbase
+
+// Permissions The permissions of a user by name, a permission is granted when present and true
+type Permissions map[string]bool
+
+// WithRequirePermissions Makes Login and LoginWithMFA fail with ErrNoPermissions when the api grants the user no
+// permission at all, which usually points to a misconfigured account rather than a user allowed to do nothing.
+// The access token and the output are still returned along with the error. Off by default
+func WithRequirePermissions(require bool) Option {
+	return func(o *options) {
+		o.requirePermissions = require
+	}
+}
+
+// Has Reports whether the given permission is granted
+func (p Permissions) Has(name string) bool {
+	return p[name]
+}
+
+// HasAll Reports whether all the given permissions are granted, true when none is given
+func (p Permissions) HasAll(names ...string) bool {
+	for _, name := range names {
+		if !p[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// HasAny Reports whether at least one of the given permissions is granted, false when none is given
+func (p Permissions) HasAny(names ...string) bool {
+	for _, name := range names {
+		if p[name] {
+			return true
+		}
+	}
+	return false
+}
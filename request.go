@@ -0,0 +1,452 @@
+package avidbase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultPageSize The number of users requested per page while listing, unless set by WithPageSize
+const defaultPageSize = 100
+
+// maxPageSize The largest number of users the api returns per page
+const maxPageSize = 1000
+
+// nextCursorHeader The response header holding the cursor of the next page of a cursor paginated list
+const nextCursorHeader = "Next-Cursor"
+
+// totalCountHeader The response header holding the number of users matching a list
+const totalCountHeader = "Total-Count"
+
+// machineRequest Makes an api call using machine access token, or the token given by WithAccessToken,
+// and decodes a successful response into out.
+// action describes the call in error messages, e.g. "list users"
+func (c *Client) machineRequest(method, path string, query url.Values, body interface{}, out interface{}, action string, opts []CallOption) (header http.Header, err error) {
+	call := newCallOptions(opts)
+	if call.account != nil && call.accessToken == "" {
+		accountOpts := append(append([]CallOption{}, opts...), withoutAccountOverride())
+		return c.forAccount(*call.account).machineRequest(method, path, query, body, out, action, accountOpts)
+	}
+	var endSpan func(error)
+	call.ctx, endSpan = c.startSpan(call.ctx, method, path)
+	defer func() { endSpan(err) }()
+	_, streamed := out.(*streamTarget)
+	if timeout := c.config.timeoutFor(method, path, streamed); timeout > 0 {
+		var cancel context.CancelFunc
+		call.ctx, cancel = context.WithTimeout(call.ctx, timeout)
+		defer cancel()
+	}
+
+	if c.isClosed() {
+		err = ErrClientClosed
+		return
+	}
+	if c.config.readOnly && isWrite(method) {
+		err = ErrReadOnly
+		return
+	}
+	if call.accessToken == "" {
+		if err = c.ensureMachineAccessToken(call.ctx); err != nil {
+			err = fmt.Errorf("invalid api key or unable to generate machine access token: %w", err)
+			return
+		}
+	}
+
+	var jsonData []byte
+	if body != nil {
+		jsonData, err = c.config.codec.Marshal(body)
+		if err != nil {
+			err = callError(method, path, "unable to json encode the "+action+" request", nil)
+			return
+		}
+	}
+
+	// The same idempotency key is sent on every attempt, making the retries of writes safe.
+	// Only a key given by the caller makes a non idempotent call retried on server errors, a generated one is just
+	// a safeguard for the retries on 429, as a caller may not know whether the api honours the header
+	idempotencyKey := call.idempotencyKey
+	if idempotencyKey == "" && isWrite(method) && c.config.retriesEnabled() {
+		idempotencyKey = newUUID()
+	}
+	idempotent := isIdempotent(method) || call.idempotencyKey != ""
+	query = call.addQueryParams(query)
+
+	// The successful body of a streamed call is neither buffered nor logged, it may be large or personal
+	reqCtx := call.ctx
+	if streamed {
+		reqCtx = context.WithValue(call.ctx, streamedKey{}, true)
+	}
+
+	var resp *http.Response
+	requestId := c.requestIdFor(call.ctx)
+	attempts := 0
+	tokenReplaced := false
+	start := c.config.clock.Now()
+	for attempt := 1; ; attempt++ {
+		attempts++
+		var req *http.Request
+		req, err = http.NewRequestWithContext(reqCtx, method, c.baseUrl+path, bytes.NewReader(jsonData))
+		if err != nil {
+			err = callError(method, path, "unable to create "+article(action)+" "+action+" request", err)
+			return
+		}
+
+		machineToken := ""
+		if call.accessToken != "" {
+			c.setAuthHeader(req, call.accessToken)
+		} else {
+			machineToken = c.getMachineAccessToken()
+			c.setAuthHeader(req, machineToken)
+		}
+		if requestId != "" {
+			req.Header.Set(requestIdHeader, requestId)
+		}
+		if idempotencyKey != "" && isWrite(method) {
+			req.Header.Set("Idempotency-Key", idempotencyKey)
+		}
+		if call.ifMatch != "" {
+			req.Header.Set("If-Match", call.ifMatch)
+		}
+		if query != nil {
+			req.URL.RawQuery = query.Encode()
+		}
+
+		resp, err = c.send(req)
+		var hookErr *hookError
+		if errors.As(err, &hookErr) {
+			return nil, hookErr.err
+		}
+		statusCode := 0
+		if err == nil {
+			statusCode = resp.StatusCode
+		}
+		if statusCode == http.StatusUnauthorized && call.accessToken == "" && !tokenReplaced {
+			// The cached token was rejected before its expiry, e.g. revoked or rotated by another client sharing it,
+			// it is replaced once without counting as a retry
+			tokenReplaced = true
+			resp.Body.Close()
+			c.dropMachineAccessToken(machineToken)
+			if err = c.ensureMachineAccessToken(call.ctx); err != nil {
+				err = fmt.Errorf("invalid api key or unable to generate machine access token: %w", err)
+				return
+			}
+			attempt--
+			continue
+		}
+		retry := false
+		switch {
+		case c.config.retryPredicate == nil:
+			retry = isRetryable(idempotent, statusCode, err, c.config.retryableStatusCodes)
+		case streamed && isSuccess(statusCode):
+			// The successful body of a streamed call is left unread for its target
+		default:
+			restore := func() {}
+			if err == nil {
+				restore = c.bufferBody(resp)
+			}
+			retry = c.config.retryPredicate(resp, err)
+			// Hand the body to the decoding from its start, whatever the predicate read
+			restore()
+		}
+		if !c.config.canRetry(attempt) || !retry {
+			break
+		}
+		delay := backoff(attempt, c.config.retryDelay, c.config.maxBackoff, c.config.jitter)
+		if c.config.retryDeadline > 0 && c.config.clock.Now().Sub(start)+delay > c.config.retryDeadline {
+			break
+		}
+		c.notifyRetry(RetryInfo{Method: method, Path: path, Attempt: attempt, Delay: delay, StatusCode: statusCode, Err: err})
+		if err == nil {
+			resp.Body.Close()
+		}
+		if err = sleep(call.ctx, c.config.clock, delay); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		err = callError(method, path, "unable to make "+article(action)+" "+action+" call", err)
+		return
+	}
+	defer resp.Body.Close()
+	call.setMeta(resp, requestId, attempts)
+
+	if !isSuccess(resp.StatusCode) {
+		err = c.newAPIError(method, path, resp, action)
+		if call.ifMatch != "" {
+			markAPIError(err, http.StatusPreconditionFailed, ErrConflict)
+		}
+		return
+	}
+
+	header = resp.Header
+	if target, ok := out.(*streamTarget); ok {
+		// read may block for long on its caller, e.g. the loop of an iterator making calls of its own
+		if body, ok := resp.Body.(*releasingBody); ok {
+			body.releaseSlot()
+		}
+		if err = target.read(resp); err != nil {
+			err = callError(method, path, "unable to read "+article(action)+" "+action+" response", err)
+		}
+		return
+	}
+	if out == nil && !c.config.detectErrorField {
+		return
+	}
+
+	data, err := ioutil.ReadAll(c.limitBody(resp.Body))
+	if errors.Is(err, ErrResponseTooLarge) {
+		return
+	}
+	if err != nil {
+		err = callError(method, path, "unable to read "+article(action)+" "+action+" response", err)
+		return
+	}
+	if c.config.detectErrorField {
+		if apiErr := errorField(method, path, resp.StatusCode, data); apiErr != nil {
+			return nil, apiErr
+		}
+	}
+	if out == nil {
+		return
+	}
+
+	//Decode the data, an empty body such as a 201 or 204 without content leaves out untouched
+	err = c.unmarshal(data, out)
+	if err == io.EOF {
+		return header, nil
+	}
+	if err != nil {
+		err = callError(method, path, "unable to decode "+article(action)+" "+action+" response", nil)
+		return
+	}
+
+	return
+}
+
+// send Makes the http call of every api request, including the machine access token generation,
+// running the request hooks and logging the exchange
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	if c.isClosed() {
+		return nil, ErrClientClosed
+	}
+
+	req.Header.Set("User-Agent", c.getUserAgent())
+	if c.config.language != "" {
+		req.Header.Set("Accept-Language", c.config.language)
+	}
+	if c.config.hostHeader != "" {
+		// net/http ignores a Host entry in the header map, the host has to be set on the request
+		req.Host = c.config.hostHeader
+	}
+
+	for _, hook := range c.config.beforeRequest {
+		if err := hook(req); err != nil {
+			return nil, &hookError{err: err}
+		}
+	}
+
+	if c.semaphore != nil {
+		select {
+		case c.semaphore <- struct{}{}:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	c.logRequest(req)
+	resp, err := c.httpClient.Do(req)
+	c.logResponse(req, resp, err)
+	if err != nil {
+		c.release()
+		return nil, err
+	}
+	if c.semaphore != nil {
+		// Keep the slot until the body is consumed, the request is in flight until then
+		resp.Body = &releasingBody{ReadCloser: resp.Body, release: c.release}
+	}
+
+	for _, hook := range c.config.afterResponse {
+		if err = hook(resp); err != nil {
+			resp.Body.Close()
+			return nil, &hookError{err: err, afterResponse: true}
+		}
+	}
+
+	return resp, nil
+}
+
+// setAuthHeader Sets the access token header of the request, Access-Token unless set by WithAuthHeader
+func (c *Client) setAuthHeader(req *http.Request, accessToken string) {
+	if c.config.authHeader == "" {
+		req.Header.Set("Access-Token", accessToken)
+		return
+	}
+	req.Header.Set(c.config.authHeader, c.config.authHeaderPrefix+accessToken)
+}
+
+// bufferBody Reads the response body, up to the maximum response size, and replaces it with a copy.
+// The returned function replaces the body with a fresh copy once read, a body that could not be read fails every
+// read with the same error
+func (c *Client) bufferBody(resp *http.Response) (restore func()) {
+	body, readErr := ioutil.ReadAll(c.limitBody(resp.Body))
+	resp.Body.Close()
+	restore = func() {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if readErr != nil {
+			resp.Body = ioutil.NopCloser(&errorReader{err: readErr})
+		}
+	}
+	restore()
+	return
+}
+
+// streamedKey The request context key marking the requests of streamed calls, whose successful body is not logged
+type streamedKey struct{}
+
+// isStreamed Reports whether the request belongs to a call whose body is streamed, see streamTarget
+func isStreamed(req *http.Request) bool {
+	streamed, _ := req.Context().Value(streamedKey{}).(bool)
+	return streamed
+}
+
+// isSuccess Reports whether the status code is a successful one
+func isSuccess(statusCode int) bool {
+	return statusCode >= 200 && statusCode <= 299
+}
+
+// streamTarget The out of a call whose successful response body is handed to read as is instead of being decoded,
+// e.g. to copy or decode it incrementally. The body is neither buffered, logged nor passed to the retry predicate,
+// read applies WithMaxResponseBytes itself if the body should be limited. The call frees its slot of
+// WithMaxConcurrentRequests before read is called, reading the body does not count against the limit
+type streamTarget struct {
+	read func(resp *http.Response) error
+}
+
+// listAllUsers Lists the users matching given query, fetching one page at a time until the last page.
+// When a page fails the users of the previous pages are returned along with the error naming the failed page
+func (c *Client) listAllUsers(query url.Values, action string, opts []CallOption) (users []Identity, err error) {
+	users = make([]Identity, 0)
+
+	call := newCallOptions(opts)
+	err = c.walkUserPages(query, opts, func(q url.Values) (header http.Header, count int, err error) {
+		page := make([]Identity, 0)
+		header, err = c.machineRequest("GET", "v1/user", q, nil, &page, action, opts)
+		if err != nil {
+			return
+		}
+		call.maskUsers(page)
+		users = append(users, page...)
+		return header, len(page), nil
+	})
+	return
+}
+
+// walkUserPages Calls fetch with the query of every page of the users matching given query, one page at a time until
+// the last page. fetch returns the response header and the number of users of its page.
+// Pages are followed using the next link of the Link header or the cursor sent by the api when available, which
+// do not skip or repeat users created while listing, falling back to offsets otherwise.
+// The error of a failed page is returned naming the page
+func (c *Client) walkUserPages(query url.Values, opts []CallOption, fetch func(q url.Values) (header http.Header, count int, err error)) (err error) {
+	call := newCallOptions(opts)
+	params := url.Values{}
+	if err = call.addSort(params); err != nil {
+		return
+	}
+	if err = call.addExclude(params); err != nil {
+		return
+	}
+	call.addIncludeDeleted(params)
+
+	pageSize := c.config.pageSize
+	cursor := ""
+	var link url.Values
+	for offset := 0; ; offset += pageSize {
+		// The next link carries the whole query of the next page, filters and sorting included
+		q := link
+		if q == nil {
+			q = url.Values{}
+			for key, values := range query {
+				q[key] = values
+			}
+			for key, values := range params {
+				q[key] = values
+			}
+			q.Set("limit", strconv.Itoa(pageSize))
+			if cursor != "" {
+				q.Set("cursor", cursor)
+			} else {
+				q.Set("offset", strconv.Itoa(offset))
+			}
+		}
+
+		header, count, fetchErr := fetch(q)
+		if fetchErr != nil {
+			return fmt.Errorf("page %d: %w", offset/pageSize+1, fetchErr)
+		}
+
+		if next, _ := pageLinks(header); next != "" {
+			link, _ = url.ParseQuery(next)
+			continue
+		}
+		if link != nil {
+			return
+		}
+		if next := header.Get(nextCursorHeader); next != "" {
+			cursor = next
+			continue
+		}
+		if cursor != "" || count < pageSize {
+			return
+		}
+	}
+}
+
+// nonNilUsers Returns the given users, or an empty slice instead of nil, e.g. after decoding a json null.
+// Methods returning a list of users always return a non nil slice so that callers do not have to tell both apart
+func nonNilUsers(users []Identity) []Identity {
+	if users == nil {
+		return make([]Identity, 0)
+	}
+	return users
+}
+
+// article Returns the indefinite article to use before the given phrase
+func article(phrase string) string {
+	if phrase != "" && strings.ContainsRune("aeiou", rune(phrase[0])) {
+		return "an"
+	}
+	return "a"
+}
+
+// release Frees the slot taken by a request when concurrent requests are limited
+func (c *Client) release() {
+	if c.semaphore != nil {
+		<-c.semaphore
+	}
+}
+
+// releasingBody Frees the concurrent request slot once the response body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.releaseSlot()
+	return err
+}
+
+// releaseSlot Frees the concurrent request slot before the body is closed, at most once
+func (b *releasingBody) releaseSlot() {
+	b.once.Do(b.release)
+}
@@ -0,0 +1,66 @@
+package avidbase
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// requestIdHeader The header used to forward the request id to the api
+const requestIdHeader = "X-Request-Id"
+
+type requestIdContextKey struct{}
+
+// ContextWithRequestID Returns a copy of ctx carrying the given request id, which is sent as the
+// X-Request-Id header of every call made using WithContext(ctx)
+func ContextWithRequestID(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdContextKey{}, requestId)
+}
+
+// WithRequestIDKey Reads the request id from the given context key, for applications that already keep
+// their own request id in the context
+func WithRequestIDKey(key interface{}) Option {
+	return func(o *options) {
+		o.requestIdKey = key
+	}
+}
+
+// WithGenerateRequestID Generates a random uuid as request id for calls whose context does not carry one,
+// the retries of a call are sent with the same id
+func WithGenerateRequestID(generate bool) Option {
+	return func(o *options) {
+		o.generateRequestId = generate
+	}
+}
+
+// setRequestId Sets the X-Request-Id header from the context, generating one if enabled, and returns it
+func (c *Client) setRequestId(ctx context.Context, req *http.Request) string {
+	requestId := c.requestIdFor(ctx)
+	if requestId != "" {
+		req.Header.Set(requestIdHeader, requestId)
+	}
+	return requestId
+}
+
+// requestIdFor Returns the request id of a call from the context, generating one if enabled, empty if none.
+// Retried calls get it once so that every attempt is sent with the same id
+func (c *Client) requestIdFor(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdContextKey{}).(string)
+	if requestId == "" && c.config.requestIdKey != nil {
+		requestId, _ = ctx.Value(c.config.requestIdKey).(string)
+	}
+	if requestId == "" && c.config.generateRequestId {
+		requestId = newUUID()
+	}
+	return requestId
+}
+
+// newUUID Generates a random (version 4) uuid
+func newUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
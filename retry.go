@@ -0,0 +1,157 @@
+package avidbase
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Jitter Defines how the exponential retry backoff is randomized so that many clients
+// recovering from the same outage do not retry in lockstep
+type Jitter int
+
+const (
+	// JitterFull Waits a random delay between zero and the exponential backoff
+	JitterFull Jitter = iota
+	// JitterEqual Waits half of the exponential backoff plus a random delay up to the other half
+	JitterEqual
+	// JitterNone Waits exactly the exponential backoff
+	JitterNone
+)
+
+// backoff Returns the delay to wait before the given retry attempt, attempt 1 being the first retry.
+// The exponential delay is capped at maxDelay, if set, before the jitter applies
+func backoff(attempt int, baseDelay, maxDelay time.Duration, jitter Jitter) time.Duration {
+	if baseDelay <= 0 {
+		return 0
+	}
+
+	delay := baseDelay
+	for i := 1; i < attempt && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+
+	switch jitter {
+	case JitterNone:
+		return delay
+	case JitterEqual:
+		half := delay / 2
+		return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+	default:
+		return time.Duration(rand.Int63n(int64(delay) + 1))
+	}
+}
+
+// RetryInfo Describes a failed attempt of a call about to be retried, see WithOnRetry
+type RetryInfo struct {
+	// Method The http method of the call, e.g. "GET"
+	Method string
+	// Path The path of the call without its query, e.g. "v1/user/123"
+	Path string
+	// Attempt The number of the failed attempt, starting at 1
+	Attempt int
+	// Delay The time waited before the next attempt
+	Delay time.Duration
+	// StatusCode The status code of the failed attempt, 0 when it failed without response
+	StatusCode int
+	// Err The error of the failed attempt, nil when it got a response
+	Err error
+}
+
+// notifyRetry Logs the retry about to happen and reports it to the function set by WithOnRetry
+func (c *Client) notifyRetry(info RetryInfo) {
+	if c.config.logger != nil {
+		reason := "status code " + strconv.Itoa(info.StatusCode)
+		if info.Err != nil {
+			reason = info.Err.Error()
+		}
+		c.config.logger.Warn("avidbase retrying request", "method", info.Method, "path", info.Path,
+			"attempt", info.Attempt, "delay", info.Delay, "reason", reason)
+	}
+	if c.config.onRetry != nil {
+		c.config.onRetry(info)
+	}
+}
+
+// isRetryable Reports whether a call should be retried after receiving the given response status code
+// or transport error. Only idempotent calls, those whose method is idempotent or given WithIdempotencyKey,
+// are retried on errors that may have been processed by the api.
+// statusCodes replaces the default retryable status codes, 429 and 5xx, when not nil
+func isRetryable(idempotent bool, statusCode int, err error, statusCodes []int) bool {
+	if statusCode == http.StatusTooManyRequests && (statusCodes == nil || containsStatusCode(statusCodes, statusCode)) {
+		return true
+	}
+	if !idempotent {
+		return false
+	}
+	if err != nil {
+		// A redirect loop does not resolve itself
+		return !errors.Is(err, ErrTooManyRedirects)
+	}
+	if statusCodes != nil {
+		return containsStatusCode(statusCodes, statusCode)
+	}
+	return statusCode >= http.StatusInternalServerError
+}
+
+// containsStatusCode Reports whether the given status code is one of statusCodes
+func containsStatusCode(statusCodes []int, statusCode int) bool {
+	for _, code := range statusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// isIdempotent Reports whether repeating a request with the given method has the same effect as making it once
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "PUT", "DELETE", "OPTIONS":
+		return true
+	}
+	return false
+}
+
+// sleep Waits for the given delay using clock, returning early with the context error if it is done first
+func sleep(ctx context.Context, clock Clock, delay time.Duration) error {
+	if _, ok := clock.(realClock); ok {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		}
+	}
+
+	// Clock.Sleep can not be interrupted, the call stops waiting for it when the context is done
+	slept := make(chan struct{})
+	go func() {
+		clock.Sleep(delay)
+		close(slept)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-slept:
+		return nil
+	}
+}
+
+// isWrite Reports whether a request with the given method changes data
+func isWrite(method string) bool {
+	switch method {
+	case "POST", "PUT", "PATCH", "DELETE":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package avidbase
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	base := 100 * time.Millisecond
+	tests := []struct {
+		name     string
+		attempt  int
+		jitter   Jitter
+		min, max time.Duration
+	}{
+		{"full first retry", 1, JitterFull, 0, base},
+		{"full third retry", 3, JitterFull, 0, 4 * base},
+		{"equal first retry", 1, JitterEqual, base / 2, base},
+		{"equal third retry", 3, JitterEqual, 2 * base, 4 * base},
+		{"none first retry", 1, JitterNone, base, base},
+		{"none third retry", 3, JitterNone, 4 * base, 4 * base},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The delays are random, sample enough of them to cover the bounds
+			for i := 0; i < 1000; i++ {
+				delay := backoff(tt.attempt, base, 0, tt.jitter)
+				if delay < tt.min || delay > tt.max {
+					t.Fatalf("backoff(%d) = %v, want between %v and %v", tt.attempt, delay, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestBackoffWithoutBaseDelay(t *testing.T) {
+	for _, jitter := range []Jitter{JitterFull, JitterEqual, JitterNone} {
+		if delay := backoff(3, 0, 0, jitter); delay != 0 {
+			t.Errorf("backoff with jitter %d = %v, want 0", jitter, delay)
+		}
+	}
+}
+
+func TestBackoffMaxDelay(t *testing.T) {
+	base := 100 * time.Millisecond
+	maxDelay := 250 * time.Millisecond
+	for _, jitter := range []Jitter{JitterFull, JitterEqual, JitterNone} {
+		for _, attempt := range []int{3, 10, 30, 100} {
+			for i := 0; i < 100; i++ {
+				if delay := backoff(attempt, base, maxDelay, jitter); delay > maxDelay {
+					t.Fatalf("backoff(%d) with jitter %d = %v, want at most %v", attempt, jitter, delay, maxDelay)
+				}
+			}
+		}
+	}
+
+	if delay := backoff(30, base, maxDelay, JitterNone); delay != maxDelay {
+		t.Errorf("backoff without jitter = %v, want the cap %v", delay, maxDelay)
+	}
+}
@@ -0,0 +1,291 @@
+package avidbase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidData Returned when the custom data of a user does not match the schema set by WithDataSchema
+var ErrInvalidData = errors.New("user data does not match the data schema")
+
+// WithDataSchema Validates the custom data of users against the given JSON Schema before CreateUser, UpdateUser
+// and UpdateUserData make the call, failing with ErrInvalidData and a description of every mismatch.
+// The keywords type, enum, properties, required, additionalProperties, items, minItems, maxItems,
+// minimum, maximum, minLength, maxLength and pattern are supported, as are annotations such as title or description.
+// A schema using any other keyword, e.g. $ref, allOf or format, is rejected: NewClient and Init then fail
+func WithDataSchema(schema []byte) Option {
+	return func(o *options) {
+		o.dataSchema = nil
+		o.dataSchemaErr = json.Unmarshal(schema, &o.dataSchema)
+		if o.dataSchemaErr == nil {
+			o.dataSchemaErr = checkSchemaKeywords(schema)
+		}
+		if o.dataSchemaErr == nil {
+			o.dataSchemaErr = o.dataSchema.compile()
+		}
+	}
+}
+
+// supportedSchemaKeywords The JSON Schema keywords enforced by the validation
+var supportedSchemaKeywords = map[string]bool{
+	"type": true, "enum": true, "properties": true, "required": true, "additionalProperties": true, "items": true,
+	"minItems": true, "maxItems": true, "minimum": true, "maximum": true, "minLength": true, "maxLength": true,
+	"pattern": true,
+}
+
+// annotationSchemaKeywords The JSON Schema keywords that do not constrain the data and can safely be ignored
+var annotationSchemaKeywords = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true, "default": true,
+	"examples": true, "deprecated": true, "readOnly": true, "writeOnly": true,
+}
+
+// checkSchemaKeywords Fails on the first keyword of the schema or its sub schemas that would not be enforced,
+// so that a schema is never silently validated more loosely than written
+func checkSchemaKeywords(schema json.RawMessage) error {
+	var keywords map[string]json.RawMessage
+	if err := json.Unmarshal(schema, &keywords); err != nil {
+		// Not an object, e.g. additionalProperties set to a boolean
+		return nil
+	}
+
+	names := make([]string, 0, len(keywords))
+	for name := range keywords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !supportedSchemaKeywords[name] && !annotationSchemaKeywords[name] {
+			return fmt.Errorf("unsupported data schema keyword %q", name)
+		}
+	}
+
+	var properties map[string]json.RawMessage
+	if err := json.Unmarshal(keywords["properties"], &properties); err == nil {
+		for _, property := range properties {
+			if err = checkSchemaKeywords(property); err != nil {
+				return err
+			}
+		}
+	}
+	if err := checkSchemaKeywords(keywords["items"]); err != nil {
+		return err
+	}
+	return checkSchemaKeywords(keywords["additionalProperties"])
+}
+
+type dataSchema struct {
+	Type                 interface{}            `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Properties           map[string]*dataSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Items                *dataSchema            `json:"items"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+
+	pattern              *regexp.Regexp
+	additionalForbidden  bool
+	additionalProperties *dataSchema
+}
+
+// compile Prepares the patterns and additional properties of the schema and its sub schemas
+func (s *dataSchema) compile() (err error) {
+	if s == nil {
+		return nil
+	}
+
+	if s.Pattern != "" {
+		if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+			return fmt.Errorf("invalid data schema pattern %q: %v", s.Pattern, err)
+		}
+	}
+
+	switch strings.TrimSpace(string(s.AdditionalProperties)) {
+	case "", "true":
+	case "false":
+		s.additionalForbidden = true
+	default:
+		if err = json.Unmarshal(s.AdditionalProperties, &s.additionalProperties); err != nil {
+			return errors.New("invalid data schema additionalProperties")
+		}
+	}
+
+	for _, property := range s.Properties {
+		if err = property.compile(); err != nil {
+			return
+		}
+	}
+	if err = s.Items.compile(); err != nil {
+		return
+	}
+	return s.additionalProperties.compile()
+}
+
+// validateData Validates the given custom data against the data schema of the client, if any
+func (c *Client) validateData(data map[string]interface{}) error {
+	if c.config.dataSchema == nil {
+		return nil
+	}
+
+	// Round trip the data through json so that it is validated exactly as the api receives it
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return errors.New("unable to json encode given user data")
+	}
+	var value interface{}
+	if err = json.Unmarshal(jsonData, &value); err != nil {
+		return errors.New("unable to json encode given user data")
+	}
+
+	problems := c.config.dataSchema.validate("data", value, nil)
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidData, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validate Appends a description of every mismatch between value and the schema to problems
+func (s *dataSchema) validate(path string, value interface{}, problems []string) []string {
+	if s == nil {
+		return problems
+	}
+
+	if types := s.types(); len(types) > 0 && !matchesType(value, types) {
+		return append(problems, path+": must be of type "+strings.Join(types, " or "))
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if jsonEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			enum, _ := json.Marshal(s.Enum)
+			problems = append(problems, path+": must be one of "+string(enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				problems = append(problems, path+"."+name+": is required")
+			}
+		}
+
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := s.Properties[name]; ok {
+				problems = property.validate(path+"."+name, v[name], problems)
+			} else if s.additionalForbidden {
+				problems = append(problems, path+"."+name+": is not allowed")
+			} else {
+				problems = s.additionalProperties.validate(path+"."+name, v[name], problems)
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			problems = append(problems, fmt.Sprintf("%s: must have at least %d items", path, *s.MinItems))
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			problems = append(problems, fmt.Sprintf("%s: must have at most %d items", path, *s.MaxItems))
+		}
+		for i, item := range v {
+			problems = s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, problems)
+		}
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			problems = append(problems, fmt.Sprintf("%s: must be at least %d characters long", path, *s.MinLength))
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			problems = append(problems, fmt.Sprintf("%s: must be at most %d characters long", path, *s.MaxLength))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			problems = append(problems, fmt.Sprintf("%s: must match pattern %q", path, s.Pattern))
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			problems = append(problems, fmt.Sprintf("%s: must be at least %v", path, *s.Minimum))
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			problems = append(problems, fmt.Sprintf("%s: must be at most %v", path, *s.Maximum))
+		}
+	}
+
+	return problems
+}
+
+// types Returns the allowed types of the schema, type being either a single name or a list of names
+func (s *dataSchema) types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, name := range t {
+			if name, ok := name.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// matchesType Reports whether the json decoded value is of one of the given JSON Schema types
+func matchesType(value interface{}, types []string) bool {
+	for _, t := range types {
+		switch v := value.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonEqual Reports whether two json decoded values are equal
+func jsonEqual(a, b interface{}) bool {
+	aJson, aErr := json.Marshal(a)
+	bJson, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && string(aJson) == string(bJson)
+}
@@ -0,0 +1,55 @@
+package avidbase
+
+import "time"
+
+// WithTimeout Limits the time spent on every call, retries included, unless a more specific timeout set by
+// WithReadTimeout, WithWriteTimeout or WithListTimeout applies. A deadline of the call context still applies,
+// the call stops at whichever comes first. No timeout is set by default
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithReadTimeout Limits the time spent on every call reading a single resource, such as GetUser, retries included.
+// It does not apply to the calls streaming their response, such as DownloadUserData, which may take much longer
+func WithReadTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.readTimeout = d
+	}
+}
+
+// WithWriteTimeout Limits the time spent on every call changing data, such as CreateUser or DeleteUser,
+// retries included
+func WithWriteTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.writeTimeout = d
+	}
+}
+
+// WithListTimeout Limits the time spent on every page request of the list and search calls, retries included.
+// The calls listing all the users make one request per page, each of them gets the full timeout.
+// It does not apply to IterateUsers, whose pages are read as fast as the users are consumed
+func WithListTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.listTimeout = d
+	}
+}
+
+// timeoutFor Returns the timeout of a call with the given method and path, 0 when none is set.
+// Streamed calls only get the timeout of WithTimeout, the others are sized for calls buffering their response
+func (o options) timeoutFor(method, path string, streamed bool) time.Duration {
+	timeout := o.writeTimeout
+	switch {
+	case streamed:
+		timeout = 0
+	case method == "GET" && (path == "v1/user" || path == "v1/user:find"):
+		timeout = o.listTimeout
+	case !isWrite(method):
+		timeout = o.readTimeout
+	}
+	if timeout > 0 {
+		return timeout
+	}
+	return o.timeout
+}
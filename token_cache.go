@@ -0,0 +1,45 @@
+package avidbase
+
+import "sync"
+
+// TokenCache Holds machine access tokens shared by several clients, created with NewTokenCache and given to the
+// clients by WithSharedTokenCache. The clients of the same account reuse the token generated by any of them instead
+// of generating their own. It is safe for concurrent use
+type TokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]*tokenState
+}
+
+// NewTokenCache Creates an empty token cache to share between clients, see WithSharedTokenCache
+func NewTokenCache() *TokenCache {
+	return &TokenCache{tokens: make(map[string]*tokenState)}
+}
+
+// WithSharedTokenCache Stores the machine access token of the client in the given cache, shared with the other
+// clients configured with it. Tokens are shared per account id, the clients of the same account must use the same
+// api key. Reset and RotateAPIKey discard the shared token, after RotateAPIKey the other clients need the new key
+func WithSharedTokenCache(cache *TokenCache) Option {
+	return func(o *options) {
+		o.tokenCache = cache
+	}
+}
+
+// state Returns the token state of the given account, created on first use
+func (t *TokenCache) state(accountId string) *tokenState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.tokens[accountId]
+	if !ok {
+		state = &tokenState{}
+		t.tokens[accountId] = state
+	}
+	return state
+}
+
+// newTokenState Returns the token state of a client of the given account, the one of the shared token cache if any
+func (o options) newTokenState(accountId *string) *tokenState {
+	if o.tokenCache == nil || accountId == nil {
+		return &tokenState{}
+	}
+	return o.tokenCache.state(*accountId)
+}
@@ -0,0 +1,94 @@
+package avidbase
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// TokenInfo Describes the machine access token of a client, as read from its claims
+type TokenInfo struct {
+	// Subject The sub claim of the token, usually the account the token was issued for
+	Subject string
+	// Scopes The scopes granted to the token, from its scope or scopes claim
+	Scopes []string
+	// IssuedAt The iat claim of the token, zero if not set
+	IssuedAt time.Time
+	// Expires The exp claim of the token, or the expiry sent along with it, zero if neither is set
+	Expires time.Time
+	// Claims All the claims of the token
+	Claims map[string]interface{}
+}
+
+// HasScope Reports whether the token was granted the given scope
+func (t TokenInfo) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// MachineTokenInfo Returns the scopes and expiry of the machine access token by decoding its claims, e.g. to find
+// out whether a 403 comes from an under privileged api key. The cached token is used, a token is only generated
+// when none is cached yet. The token signature is not verified, the result is meant for diagnosis only
+func (c *Client) MachineTokenInfo() (info TokenInfo, err error) {
+	// Any cached token will do, even one sent without expiry which the calls would replace
+	if !c.HasMachineToken() {
+		if err = c.generateMachineAccessToken(context.Background()); err != nil {
+			return
+		}
+	}
+
+	c.tokens.mu.RLock()
+	accessToken := StringValue(c.tokens.machineAccessToken)
+	expiry := c.tokens.expiry
+	c.tokens.mu.RUnlock()
+
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		err = errors.New("machine access token is not a JWT, its claims can not be read")
+		return
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		err = errors.New("unable to decode the machine access token claims")
+		return
+	}
+	if err = json.Unmarshal(payload, &info.Claims); err != nil {
+		err = errors.New("unable to decode the machine access token claims")
+		return
+	}
+
+	info.Subject, _ = info.Claims["sub"].(string)
+	if scopes, ok := info.Claims["scope"].(string); ok {
+		info.Scopes = strings.Fields(scopes)
+	} else if scopes, ok := info.Claims["scopes"].([]interface{}); ok {
+		for _, scope := range scopes {
+			if scope, ok := scope.(string); ok {
+				info.Scopes = append(info.Scopes, scope)
+			}
+		}
+	}
+	if info.Scopes == nil {
+		info.Scopes = make([]string, 0)
+	}
+	if iat, ok := info.Claims["iat"].(float64); ok {
+		info.IssuedAt = time.Unix(int64(iat), 0)
+	}
+	info.Expires = expiry
+	if exp, ok := info.Claims["exp"].(float64); ok {
+		info.Expires = time.Unix(int64(exp), 0)
+	}
+
+	return
+}
+
+// MachineTokenInfo Returns the scopes and expiry of the machine access token of the default client
+func MachineTokenInfo() (TokenInfo, error) {
+	return getDefaultClient().MachineTokenInfo()
+}
@@ -0,0 +1,66 @@
+package avidbase
+
+import (
+	"context"
+	"strings"
+)
+
+// Tracer Starts the spans recording the api calls, e.g. an adapter over an OpenTelemetry tracer
+type Tracer interface {
+	// Start Starts a span with the given name as a child of the span of ctx, if any, returning a context carrying it
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span A span started by a Tracer, ended once its api call completes
+type Span interface {
+	// End Ends the span, err is the error the call failed with or nil
+	End(err error)
+}
+
+// WithTracer Records every api call, retries included, as a span started by the given tracer.
+// Spans are named "METHOD path" with the ids of the path templated, e.g. "GET v1/user/{id}", unless set by
+// WithSpanNameFormatter
+func WithTracer(tracer Tracer) Option {
+	return func(o *options) {
+		o.tracer = tracer
+	}
+}
+
+// WithSpanNameFormatter Names the spans of the api calls using the given function instead of the default
+// "METHOD path" scheme. path is the raw path of the call, e.g. "v1/user/123", without its query. Keep the names low
+// cardinality by templating the ids of the path, most tracing backends index span names
+func WithSpanNameFormatter(formatter func(method, path string) string) Option {
+	return func(o *options) {
+		o.spanNameFormatter = formatter
+	}
+}
+
+// idCollections The path segments followed by the id of one of their resources, e.g. "user" in "v1/user/123"
+var idCollections = []string{"account", "user", "group", "role"}
+
+// defaultSpanName Returns "METHOD path" with the ids of the path replaced by {id}, e.g. "GET v1/user/{id}/group"
+// for "GET v1/user/123/group". Custom actions such as "v1/user/email_change:confirm" are kept as they are
+func defaultSpanName(method, path string) string {
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments); i++ {
+		if contains(idCollections, segments[i-1]) && segments[i] != "" && !strings.Contains(segments[i], ":") {
+			segments[i] = "{id}"
+		}
+	}
+	return method + " " + strings.Join(segments, "/")
+}
+
+// startSpan Starts the span of an api call when a tracer is set, the returned function ends it.
+// Without a tracer ctx is returned as is along with a no-op function
+func (c *Client) startSpan(ctx context.Context, method, path string) (context.Context, func(err error)) {
+	if c.config.tracer == nil {
+		return ctx, func(error) {}
+	}
+
+	name := defaultSpanName(method, path)
+	if c.config.spanNameFormatter != nil {
+		name = c.config.spanNameFormatter(method, path)
+	}
+	ctx, span := c.config.tracer.Start(ctx, name)
+	return ctx, span.End
+}
@@ -0,0 +1,160 @@
+package avidbase
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// defaultMaxRedirects The number of redirects followed by a call, unless set by WithMaxRedirects
+const defaultMaxRedirects = 10
+
+// newHTTPClient Builds the http client used by all the calls of a client, including the machine access token generation
+func newHTTPClient(o options) *http.Client {
+	if o.transport != nil {
+		return &http.Client{Transport: o.transport, CheckRedirect: checkRedirect(o.maxRedirects)}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{MinVersion: o.minTLSVersion}
+	if o.insecureSkipVerify {
+		transport.TLSClientConfig.InsecureSkipVerify = true
+		warnInsecure(o.logger)
+	}
+	transport.DialContext = (&net.Dialer{Timeout: o.dialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = o.tlsHandshakeTimeout
+	transport.ResponseHeaderTimeout = o.headerTimeout
+	transport.DisableKeepAlives = o.disableKeepAlives
+
+	return &http.Client{Transport: transport, CheckRedirect: checkRedirect(o.maxRedirects)}
+}
+
+// checkRedirect Returns the redirect policy following at most maxRedirects redirects, none at all when 0
+func checkRedirect(maxRedirects int) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if maxRedirects == 0 {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("%w: stopped after %d redirects, the last one to %s", ErrTooManyRedirects, maxRedirects, req.URL.Redacted())
+		}
+		return nil
+	}
+}
+
+// WithTransport Makes the calls through the given transport, e.g. one wrapped for instrumentation such as
+// otelhttp.NewTransport(http.DefaultTransport). The transport is used as given: WithMinTLSVersion, WithDialTimeout,
+// WithTLSHandshakeTimeout, WithResponseHeaderTimeout and WithDisableKeepAlives do not apply to it
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
+
+// WithInsecureSkipVerify Disables the verification of the TLS certificate of the api, for local development only,
+// e.g. against a dev server with a self-signed certificate.
+//
+// WARNING: the client then accepts any certificate, anyone able to intercept the connection can impersonate the api
+// and read the api key, the tokens and the user data sent over it. Never use it in production nor against a remote
+// server. A warning is logged for every client created with it, using the logger set by WithLogger or the standard
+// logger otherwise. It does not apply to a transport given to WithTransport
+func WithInsecureSkipVerify() Option {
+	return func(o *options) {
+		o.insecureSkipVerify = true
+	}
+}
+
+// warnInsecure Logs that the TLS certificate of the api is not verified
+func warnInsecure(logger Logger) {
+	const msg = "avidbase TLS certificate verification is disabled by WithInsecureSkipVerify, never use it in production"
+	if logger != nil {
+		logger.Warn(msg)
+		return
+	}
+	log.Println("WARNING: " + msg)
+}
+
+// WithMinTLSVersion Sets the minimum TLS version accepted when connecting to the api, e.g. tls.VersionTLS13.
+// Defaults to TLS 1.2
+func WithMinTLSVersion(version uint16) Option {
+	return func(o *options) {
+		o.minTLSVersion = version
+	}
+}
+
+// WithDialTimeout Limits the time spent establishing a connection to the api, defaults to 30 seconds
+func WithDialTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = d
+	}
+}
+
+// WithTLSHandshakeTimeout Limits the time spent on the TLS handshake with the api, defaults to 10 seconds
+func WithTLSHandshakeTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.tlsHandshakeTimeout = d
+	}
+}
+
+// WithResponseHeaderTimeout Limits the time waited for the headers of a response once the request is sent, failing
+// fast on an api that accepts the connection but stalls, without limiting the time spent reading a slow body.
+// No limit by default besides the timeouts of the call
+func WithResponseHeaderTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.headerTimeout = d
+	}
+}
+
+// WithDisableKeepAlives Opens a new connection for every call instead of reusing idle connections, e.g. for short
+// lived serverless invocations where kept alive connections break across cold starts. Keep-alives are enabled by default.
+// It does not apply to a transport given to WithTransport
+func WithDisableKeepAlives(disable bool) Option {
+	return func(o *options) {
+		o.disableKeepAlives = disable
+	}
+}
+
+// WithMaxRedirects Limits the number of redirects followed by a call, 10 by default. A call redirected more often
+// fails with an error matching ErrTooManyRedirects. 0 disables following redirects, a redirected call then fails
+// with an *APIError carrying the redirect status code
+func WithMaxRedirects(n int) Option {
+	return func(o *options) {
+		if n < 0 {
+			n = 0
+		}
+		o.maxRedirects = n
+	}
+}
+
+// WithMaxResponseBytes Limits the size of the response bodies read by the sdk, protecting against a misbehaving
+// endpoint streaming unbounded data. Larger responses fail with ErrResponseTooLarge. Defaults to 32MB
+func WithMaxResponseBytes(n int64) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxResponseBytes = n
+		}
+	}
+}
+
+// limitBody Wraps a response body so that reading past the maximum response size fails with ErrResponseTooLarge
+func (c *Client) limitBody(body io.Reader) io.Reader {
+	return &limitedReader{reader: io.LimitReader(body, c.config.maxResponseBytes+1), remaining: c.config.maxResponseBytes}
+}
+
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (n int, err error) {
+	n, err = l.reader.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	return
+}
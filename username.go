@@ -0,0 +1,41 @@
+package avidbase
+
+import "strings"
+
+// usernameNormalization How usernames are normalized, as set by WithUsernameNormalization
+type usernameNormalization int
+
+const (
+	usernameAsIs usernameNormalization = iota
+	usernameTrim
+	usernameTrimLower
+)
+
+// NormalizeUsername Returns the username without its leading and trailing whitespace, lowercased if asked
+func NormalizeUsername(username string, lowercase bool) string {
+	username = strings.TrimSpace(username)
+	if lowercase {
+		username = strings.ToLower(username)
+	}
+	return username
+}
+
+// WithUsernameNormalization Normalizes the usernames given to CreateUser and Login using NormalizeUsername,
+// trimming the whitespace pasted along with them and lowercasing them if asked, for accounts where usernames
+// are case insensitive. By default usernames are sent as given
+func WithUsernameNormalization(lowercase bool) Option {
+	return func(o *options) {
+		o.usernameNormalization = usernameTrim
+		if lowercase {
+			o.usernameNormalization = usernameTrimLower
+		}
+	}
+}
+
+// normalizeUsername Normalizes the given username as configured by WithUsernameNormalization
+func (c *Client) normalizeUsername(username string) string {
+	if c.config.usernameNormalization == usernameAsIs {
+		return username
+	}
+	return NormalizeUsername(username, c.config.usernameNormalization == usernameTrimLower)
+}
@@ -0,0 +1,40 @@
+package avidbase
+
+import (
+	"errors"
+	"fmt"
+)
+
+// VerifyCredentials Checks that the api key is valid and returns the permissions granted to its machine access token,
+// e.g. before a migration. The check uses a token of its own, the cached machine access token is neither used nor
+// replaced, WithRevokeToken revokes that token afterwards. An invalid api key fails with an error matching
+// ErrUnauthorized
+func (c *Client) VerifyCredentials(opts ...CallOption) (permissions Permissions, err error) {
+	call := newCallOptions(opts)
+
+	accessToken, _, err := c.fetchMachineAccessToken(call.ctx)
+	if errors.Is(err, ErrUnauthorized) {
+		return nil, fmt.Errorf("invalid api key: %w", err)
+	}
+	if err != nil {
+		return
+	}
+
+	permissions, err = c.GetPermissions(accessToken, opts...)
+	if !call.revokeToken {
+		return
+	}
+
+	// The token is revoked even if the permissions could not be read
+	revokeOpts := append(opts[:len(opts):len(opts)], WithAccessToken(accessToken))
+	_, revokeErr := c.machineRequest("DELETE", "v1/account/"+*c.accountId+"/token", nil, nil, nil, "revoke token", revokeOpts)
+	if err == nil && revokeErr != nil {
+		err = revokeErr
+	}
+	return
+}
+
+// VerifyCredentials Checks that the api key of the default client is valid and returns the permissions of its machine access token
+func VerifyCredentials(opts ...CallOption) (Permissions, error) {
+	return getDefaultClient().VerifyCredentials(opts...)
+}
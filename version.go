@@ -0,0 +1,23 @@
+package avidbase
+
+// Version The version of the sdk, sent in the User-Agent header of every request
+const Version = "0.1.0"
+
+// userAgent The User-Agent identifying the sdk, followed by the suffix set by WithUserAgentSuffix
+const userAgent = "avidbase-sdk-go/" + Version
+
+// WithUserAgentSuffix Appends the given product, e.g. "myapp/4.5.6", to the User-Agent of every request, which then
+// reads "avidbase-sdk-go/<version> myapp/4.5.6"
+func WithUserAgentSuffix(suffix string) Option {
+	return func(o *options) {
+		o.userAgentSuffix = suffix
+	}
+}
+
+// getUserAgent Returns the User-Agent sent by the client
+func (c *Client) getUserAgent() string {
+	if c.config.userAgentSuffix == "" {
+		return userAgent
+	}
+	return userAgent + " " + c.config.userAgentSuffix
+}